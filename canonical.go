@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Query parameters that only identify where a link was shared from. A
+// trailing * matches any suffix.
+var defaultStripParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+	"ref_src",
+}
+
+// Hosts that only redirect to the real article, such as feed proxies and
+// link shorteners.
+var defaultRedirectorHosts = []string{
+	"feedproxy.google.com",
+	"feeds.feedburner.com",
+	"t.co",
+	"bit.ly",
+	"ow.ly",
+	"buff.ly",
+	"dlvr.it",
+	"ift.tt",
+	"trib.al",
+	"lnkd.in",
+}
+
+// Redirectors that don't answer within this long are left unresolved.
+const redirectTimeout = 10 * time.Second
+
+// urlCanonicalizer holds the rules used to clean up post links, combining the
+// defaults above with any extras from the config file.
+type urlCanonicalizer struct {
+	stripParams     []string
+	redirectorHosts map[string]bool
+}
+
+func newURLCanonicalizer(s *state) urlCanonicalizer {
+	c := urlCanonicalizer{
+		stripParams:     append(append([]string{}, defaultStripParams...), s.cfg.StripParams...),
+		redirectorHosts: map[string]bool{},
+	}
+	for _, host := range append(defaultRedirectorHosts, s.cfg.RedirectorHosts...) {
+		c.redirectorHosts[strings.ToLower(host)] = true
+	}
+	return c
+}
+
+// canonicalize returns the link a post should be stored, displayed and
+// deduplicated under: redirector links are followed to their destination,
+// tracking parameters and fragments are removed and the host is lowercased.
+// Links that can't be parsed are returned unchanged.
+func (c urlCanonicalizer) canonicalize(ctx context.Context, link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+	if c.redirectorHosts[strings.ToLower(u.Hostname())] {
+		if resolved, err := resolveRedirect(ctx, link); err == nil {
+			if parsed, err := url.Parse(resolved); err == nil && parsed.Host != "" {
+				u = parsed
+			}
+		}
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.RawQuery != "" {
+		// Rebuild the query by hand rather than with url.Values.Encode so
+		// the remaining parameters keep their order and encoding
+		kept := []string{}
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			key, _, _ := strings.Cut(param, "=")
+			if name, err := url.QueryUnescape(key); err == nil && c.isTrackingParam(name) {
+				continue
+			}
+			if param != "" {
+				kept = append(kept, param)
+			}
+		}
+		u.RawQuery = strings.Join(kept, "&")
+	}
+	return u.String()
+}
+
+func (c urlCanonicalizer) isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range c.stripParams {
+		pattern = strings.ToLower(pattern)
+		if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRedirect follows a link's redirects with a HEAD request and returns
+// the final url.
+func resolveRedirect(ctx context.Context, link string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, redirectTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "HEAD", link, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("User-Agent", "gator")
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	return response.Request.URL.String(), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+const (
+	// Posts whose SimHashes differ in at most this many bits are treated as
+	// the same story.
+	maxSimhashDistance = 3
+	// How far back to look for a similar story. URL matches are always found.
+	clusterWindow = 7 * 24 * time.Hour
+	// Bodies shorter than this many words are too short to compare reliably.
+	minSimhashWords = 8
+)
+
+// normalizeURL reduces a canonical link to a key that is the same for every
+// copy of a story: the scheme, "www." and trailing slashes are removed, and
+// query parameters are sorted.
+func normalizeURL(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(link)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	// http and https copies of a page are the same story
+	normalized := "//" + host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(params) > 0 {
+		normalized += "?" + strings.Join(params, "&")
+	}
+	return normalized
+}
+
+// normalizeStoredURLs fills in the normalized links of posts stored before
+// clustering was added, which the migration leaves empty so that they are
+// normalized by normalizeURL exactly as new posts are. Each post joins the
+// cluster of the first earlier post with the same link.
+func normalizeStoredURLs(ctx context.Context, s *state) error {
+	params := database.GetPostsWithoutNormalizedURLParams{Limit: 500}
+	count := 0
+	for {
+		posts, err := s.dbq.GetPostsWithoutNormalizedURL(ctx, params)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve posts to normalize: %w", err)
+		}
+		if len(posts) == 0 {
+			break
+		}
+		for _, post := range posts {
+			// Posts are visited oldest first, so earlier copies are already
+			// normalized when a later one looks for them
+			if normalized := normalizeURL(post.Url); normalized != "" {
+				err = s.dbq.SetPostNormalizedURL(ctx, database.SetPostNormalizedURLParams{
+					NormalizedUrl: normalized,
+					UpdatedAt:     time.Now(),
+					ID:            post.ID,
+				})
+				if err != nil {
+					return fmt.Errorf("unable to store normalized link: %w", err)
+				}
+				count++
+			}
+			params.AfterCreatedAt = post.CreatedAt
+			params.AfterID = post.ID
+		}
+	}
+	if count > 0 {
+		fmt.Printf("Normalized the links of %d stored posts\n", count)
+	}
+	return nil
+}
+
+// simhash fingerprints a post's title and body so that near-identical text
+// gives fingerprints differing in only a few bits. It returns 0 for text too
+// short to fingerprint.
+func simhash(title, body string) int64 {
+	words := strings.FieldsFunc(strings.ToLower(title+" "+htmlText(body)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < minSimhashWords {
+		return 0
+	}
+
+	var weights [64]int
+	for _, word := range words {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return int64(fingerprint)
+}
+
+// assignCluster adds a new post to the cluster of an earlier copy of the same
+// story, if there is one. New posts start in a cluster of their own.
+func assignCluster(post database.Post, ctx context.Context, q *database.Queries) error {
+	clusterID, err := q.FindPostCluster(ctx, database.FindPostClusterParams{
+		ID:            post.ID,
+		NormalizedUrl: post.NormalizedUrl,
+		Simhash:       post.Simhash,
+		Since:         time.Now().Add(-clusterWindow),
+		MaxDistance:   maxSimhashDistance,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to look for duplicate posts: %w", err)
+	}
+	err = q.SetPostCluster(ctx, database.SetPostClusterParams{
+		ClusterID: clusterID,
+		UpdatedAt: time.Now(),
+		ID:        post.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to group duplicate post: %w", err)
+	}
+	return nil
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -99,22 +105,96 @@ func handlerUsers(s *state, cmd command) error {
 }
 
 func handlerAggregator(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		return fmt.Errorf("expected one argument: agg <time_between_reqs>")
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	prune := flags.Bool("prune", false, "prune posts with the configured retention policy after each collection")
+	digest := flags.Bool("digest", false, "send due email digests after each collection")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: agg [--prune] [--digest] <time_between_reqs>")
 	}
-	duration := cmd.args[0]
+	duration := args[0]
 	timeBetween, err := time.ParseDuration(duration)
 	if err != nil {
 		return fmt.Errorf("unable to convert duration: %w", err)
 	}
+	policy, err := configRetentionPolicy(s)
+	if err != nil {
+		return err
+	}
+	s.hooks, err = configHookRunner(context.Background(), s)
+	if err != nil {
+		return err
+	}
+	if s.hooks != nil {
+		// Hooks still waiting when the aggregator stops are skipped
+		defer s.hooks.stop()
+	}
+	s.websub, err = startWebSub(s)
+	if err != nil {
+		return err
+	}
+	s.webhooks = startWebhookDispatcher(s)
+	// Webhooks still waiting when the aggregator stops are logged as failed
+	defer s.webhooks.stop()
+	if s.websub != nil {
+		// Stopped first, as storing pushed posts queues hooks and webhooks
+		defer s.websub.stop()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = normalizeStoredURLs(ctx, s)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Collecting feeds every %s\n", duration)
 
 	ticker := time.NewTicker(timeBetween)
-	for ; ; <-ticker.C {
-		err := scrapeFeeds(context.Background(), s)
+	for {
+		err := scrapeFeeds(ctx, s)
+		if ctx.Err() != nil {
+			fmt.Println("Stopping")
+			return nil
+		}
 		if err != nil {
 			return fmt.Errorf("failed to scrape feed: %w", err)
 		}
+		if s.websub != nil {
+			err = s.websub.renew(ctx, s)
+			if ctx.Err() != nil {
+				fmt.Println("Stopping")
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to renew WebSub subscriptions: %w", err)
+			}
+		}
+		if *prune {
+			pruned, err := prunePosts(context.Background(), s, policy, false)
+			if err != nil {
+				return fmt.Errorf("failed to prune posts: %w", err)
+			}
+			if len(pruned) > 0 {
+				fmt.Printf("Pruned %d posts\n", len(pruned))
+			}
+		}
+		if *digest {
+			sent, err := sendDueDigests(context.Background(), s)
+			if err != nil {
+				return fmt.Errorf("failed to send digests: %w", err)
+			}
+			if sent > 0 {
+				fmt.Printf("Sent %d digests\n", sent)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			fmt.Println("Stopping")
+			return nil
+		}
 	}
 }
 
@@ -159,6 +239,80 @@ func handlerGetFeeds(s *state, cmd command) error {
 	return nil
 }
 
+func handlerFeedInfo(s *state, cmd command) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: feedinfo <feed_url>")
+	}
+	feed, err := s.dbq.GetFeedInfo(context.Background(), cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("feed url not found: %w", err)
+	}
+	fmt.Printf("Name:        %s\n", feed.Name)
+	fmt.Printf("URL:         %s\n", feed.Url)
+	fmt.Printf("Added by:    %s\n", feed.AddedBy)
+	fmt.Printf("Title:       %s\n", feed.Title)
+	fmt.Printf("Description: %s\n", feed.Description)
+	fmt.Printf("Site:        %s\n", feed.SiteLink)
+	fmt.Printf("Language:    %s\n", feed.Language)
+	fmt.Printf("Image:       %s\n", feed.ImageUrl)
+	fmt.Printf("Generator:   %s\n", feed.Generator)
+	fmt.Printf("Followers:   %d\n", feed.FollowerCount)
+	fmt.Printf("Posts:       %d\n", feed.PostCount)
+	if feed.LastFetchedAt.Valid {
+		fmt.Printf("Last fetch:  %s\n", feed.LastFetchedAt.Time.Format(time.RFC1123))
+	} else {
+		fmt.Println("Last fetch:  never")
+	}
+	if feed.LastFetchStatus.Valid {
+		fmt.Printf("Status:      %s\n", feed.LastFetchStatus.String)
+	}
+	fmt.Printf("Full content: %t\n", feed.FetchFullContent)
+	fmt.Printf("Retention:   max age %s, max posts %s\n",
+		describeRetention(feed.RetentionMaxAgeDays, "d"), describeRetention(feed.RetentionMaxPosts, ""))
+	subscription, err := s.dbq.GetWebSubSubscription(context.Background(), feed.ID)
+	switch {
+	case err == nil:
+		fmt.Printf("WebSub:      %s via <%s>", subscription.State, subscription.HubUrl)
+		if subscription.LeaseExpiresAt.Valid {
+			fmt.Printf(", lease until %s", subscription.LeaseExpiresAt.Time.Format(time.RFC1123))
+		}
+		fmt.Println()
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("unable to look up WebSub subscription: %w", err)
+	}
+	return nil
+}
+
+func handlerFullContent(s *state, cmd command) error {
+	if len(cmd.args) != 2 {
+		return fmt.Errorf("wrong number of arguments: expected 'fullcontent <feed_url> <on|off>'")
+	}
+	feedUrl, setting := cmd.args[0], cmd.args[1]
+	var enabled bool
+	switch setting {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return fmt.Errorf("argument %s not recognised: expected 'on' or 'off'", setting)
+	}
+	feed, err := s.dbq.GetFeedByURL(context.Background(), feedUrl)
+	if err != nil {
+		return fmt.Errorf("feed url not found: %w", err)
+	}
+	err = s.dbq.SetFeedFetchFullContent(context.Background(), database.SetFeedFetchFullContentParams{
+		FetchFullContent: enabled,
+		UpdatedAt:        time.Now(),
+		Url:              feed.Url,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update feed: %w", err)
+	}
+	fmt.Printf("Full content fetching for '%s' turned %s\n", feed.Name, setting)
+	return nil
+}
+
 func handlerFollow(s *state, cmd command, loggedInUser database.User) error {
 	if len(cmd.args) != 1 {
 		return fmt.Errorf("wrong number of arguments: expected 'follow <url>")
@@ -186,14 +340,180 @@ func handlerFollowing(s *state, cmd command) error {
 	if len(cmd.args) != 0 {
 		return fmt.Errorf("expected no arguments, received %d", len(cmd.args))
 	}
-	follows, err := s.dbq.GetFeedFollowsForUser(context.Background(), s.cfg.Username)
+	follows, err := s.dbq.GetFollowingWithTags(context.Background(), s.cfg.Username)
 	if err != nil {
 		return fmt.Errorf("current user follows not found: %w", err)
 	}
 	fmt.Printf("%s's feeds:\n", s.cfg.Username)
-	for _, feed := range follows {
-		fmt.Printf("* %s\n", feed.FeedName)
+	// Rows are ordered by tag with untagged feeds last, so print a heading
+	// whenever the tag changes
+	currentTag := ""
+	for i, follow := range follows {
+		tag := "Untagged"
+		if follow.Tag.Valid {
+			tag = follow.Tag.String
+		}
+		if i == 0 || tag != currentTag {
+			fmt.Printf("[%s]\n", tag)
+			currentTag = tag
+		}
+		name := follow.FeedName
+		if follow.DisplayTitle.Valid {
+			name = follow.DisplayTitle.String
+		}
+		settings := ""
+		if follow.Muted {
+			settings += " (muted)"
+		}
+		if follow.Notify != notifyAll {
+			settings += fmt.Sprintf(" (notify: %s)", follow.Notify)
+		}
+		fmt.Printf("* %s <%s>%s\n", name, follow.FeedUrl, settings)
+	}
+	return nil
+}
+
+const (
+	notifyAll        = "all"
+	notifyHighlights = "highlights"
+	notifyNone       = "none"
+)
+
+// updateFollowSettings applies change to the logged in user's follow of
+// feedUrl and saves the result.
+func updateFollowSettings(s *state, loggedInUser database.User, feedUrl string, change func(*database.FeedFollow)) error {
+	follow, err := s.dbq.GetFeedFollow(context.Background(), database.GetFeedFollowParams{
+		UserID: loggedInUser.ID,
+		Url:    feedUrl,
+	})
+	if err != nil {
+		return fmt.Errorf("not following feed at '%s': %w", feedUrl, err)
+	}
+	change(&follow)
+	err = s.dbq.UpdateFeedFollowSettings(context.Background(), database.UpdateFeedFollowSettingsParams{
+		DisplayTitle: follow.DisplayTitle,
+		Muted:        follow.Muted,
+		Notify:       follow.Notify,
+		UpdatedAt:    time.Now(),
+		ID:           follow.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update follow settings: %w", err)
+	}
+	return nil
+}
+
+func handlerRename(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) < 1 || len(cmd.args) > 2 {
+		return fmt.Errorf("wrong number of arguments: expected 'rename <feed_url> (<title>)'")
+	}
+	title := ""
+	if len(cmd.args) == 2 {
+		title = strings.TrimSpace(cmd.args[1])
+	}
+	err := updateFollowSettings(s, loggedInUser, cmd.args[0], func(follow *database.FeedFollow) {
+		follow.DisplayTitle = optionalString(title)
+	})
+	if err != nil {
+		return err
+	}
+	if title == "" {
+		fmt.Printf("Reset title of '%s'\n", cmd.args[0])
+	} else {
+		fmt.Printf("Renamed '%s' to '%s'\n", cmd.args[0], title)
+	}
+	return nil
+}
+
+func handlerMute(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: %s <feed_url>", cmd.name)
+	}
+	muted := cmd.name == "mute"
+	err := updateFollowSettings(s, loggedInUser, cmd.args[0], func(follow *database.FeedFollow) {
+		follow.Muted = muted
+	})
+	if err != nil {
+		return err
+	}
+	if muted {
+		fmt.Printf("Muted '%s'\n", cmd.args[0])
+	} else {
+		fmt.Printf("Unmuted '%s'\n", cmd.args[0])
+	}
+	return nil
+}
+
+func handlerNotify(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 2 {
+		return fmt.Errorf("wrong number of arguments: expected 'notify <feed_url> <all|highlights|none>'")
+	}
+	preference := cmd.args[1]
+	switch preference {
+	case notifyAll, notifyHighlights, notifyNone:
+	default:
+		return fmt.Errorf("argument %s not recognised: expected all, highlights or none", preference)
+	}
+	err := updateFollowSettings(s, loggedInUser, cmd.args[0], func(follow *database.FeedFollow) {
+		follow.Notify = preference
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Notifications for '%s' set to '%s'\n", cmd.args[0], preference)
+	return nil
+}
+
+func handlerTag(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 2 {
+		return fmt.Errorf("wrong number of arguments: expected 'tag <feed_url> <tag>'")
+	}
+	feedUrl, tag := cmd.args[0], strings.TrimSpace(cmd.args[1])
+	if tag == "" {
+		return fmt.Errorf("tag must not be empty")
+	}
+	follow, err := s.dbq.GetFeedFollow(context.Background(), database.GetFeedFollowParams{
+		UserID: loggedInUser.ID,
+		Url:    feedUrl,
+	})
+	if err != nil {
+		return fmt.Errorf("not following feed at '%s': %w", feedUrl, err)
+	}
+	err = s.dbq.AddFeedFollowTag(context.Background(), database.AddFeedFollowTagParams{
+		FeedFollowID: follow.ID,
+		Tag:          tag,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to tag feed: %w", err)
+	}
+	fmt.Printf("Tagged '%s' with '%s'\n", feedUrl, tag)
+	return nil
+}
+
+func handlerUntag(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 2 {
+		return fmt.Errorf("wrong number of arguments: expected 'untag <feed_url> <tag>'")
+	}
+	feedUrl, tag := cmd.args[0], strings.TrimSpace(cmd.args[1])
+	follow, err := s.dbq.GetFeedFollow(context.Background(), database.GetFeedFollowParams{
+		UserID: loggedInUser.ID,
+		Url:    feedUrl,
+	})
+	if err != nil {
+		return fmt.Errorf("not following feed at '%s': %w", feedUrl, err)
 	}
+	count, err := s.dbq.RemoveFeedFollowTag(context.Background(), database.RemoveFeedFollowTagParams{
+		FeedFollowID: follow.ID,
+		Tag:          tag,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to untag feed: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("feed at '%s' is not tagged '%s'", feedUrl, tag)
+	}
+	fmt.Printf("Removed tag '%s' from '%s'\n", tag, feedUrl)
 	return nil
 }
 
@@ -214,29 +534,303 @@ func handlerUnfollow(s *state, cmd command, loggedInUser database.User) error {
 }
 
 func handlerBrowse(s *state, cmd command, loggedInUser database.User) error {
-	if len(cmd.args) > 1 {
-		return fmt.Errorf("too many argurments: browse (<limit>)")
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	filter := addPostFilterFlags(flags)
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many argurments: browse [flags] (<limit>)")
 	}
 	limit := 2
-	if len(cmd.args) == 1 {
-		i, err := strconv.Atoi(cmd.args[0])
+	if len(args) == 1 {
+		i, err := strconv.Atoi(args[0])
 		if err != nil {
-			return fmt.Errorf("argument %s not recognised as integer: %w", cmd.args[0], err)
+			return fmt.Errorf("argument %s not recognised as integer: %w", args[0], err)
 		}
 		limit = i
 	}
-	posts, err := s.dbq.GetUserPosts(context.Background(), database.GetUserPostsParams{
-		UserID: loggedInUser.ID,
-		Limit:  int32(limit),
-	})
+	params, err := filter.params(loggedInUser.ID, limit)
+	if err != nil {
+		return err
+	}
+	posts, err := s.dbq.GetUserPosts(context.Background(), params)
 	if err != nil {
 		return fmt.Errorf("unable to retrieve user's posts: %w", err)
 	}
+	if len(posts) == 0 {
+		if params.UnreadOnly {
+			fmt.Println("No unread posts")
+		} else {
+			fmt.Println("No posts")
+		}
+	}
 	for _, item := range posts {
+		if item.Highlighted {
+			fmt.Print("★ ")
+		}
 		fmt.Printf("\"%s\" <%s>\n", item.Title, item.Url)
-		fmt.Println("Posted at:", item.PublishedAt)
-		fmt.Println(item.Description)
+		fmt.Println("Post ID:", item.ID)
+		fmt.Println("Feed:", item.FeedName)
+		sources, err := s.dbq.GetClusterSources(context.Background(), database.GetClusterSourcesParams{
+			ClusterID: item.ClusterID,
+			UserID:    loggedInUser.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to retrieve post's other sources: %w", err)
+		}
+		for _, source := range sources {
+			if source.ID != item.ID {
+				fmt.Printf("Also in: %s <%s>\n", source.FeedName, source.Url)
+			}
+		}
+		fmt.Println("Posted at:", item.PublishedAt.Time)
+		if item.Author != "" {
+			fmt.Println("Author:", item.Author)
+		}
+		categories, err := s.dbq.GetPostCategories(context.Background(), item.ID)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve post's categories: %w", err)
+		}
+		if len(categories) > 0 {
+			fmt.Println("Categories:", strings.Join(categories, ", "))
+		}
+		fmt.Println(renderText(postBody(item.Description, item.Content), terminalWidth()))
+		enclosures, err := s.dbq.GetPostEnclosures(context.Background(), item.ID)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve post's enclosures: %w", err)
+		}
+		for _, enclosure := range enclosures {
+			fmt.Printf("Enclosure: <%s> %s\n", enclosure.Url, describeEnclosure(enclosure))
+		}
+		media, err := s.dbq.GetPostMedia(context.Background(), item.ID)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve post's media: %w", err)
+		}
+		if thumbnail, ok := postThumbnail(media); ok {
+			fmt.Printf("Thumbnail: <%s>\n", thumbnail.Url)
+		}
+		for _, medium := range media {
+			if medium.Kind == mediaKindContent {
+				fmt.Printf("Media: <%s> %s\n", medium.Url, medium.MimeType)
+			}
+		}
 		fmt.Println("")
+		// Every copy of the story has now been seen
+		for _, source := range sources {
+			err = s.dbq.MarkPostRead(context.Background(), database.MarkPostReadParams{
+				UserID: loggedInUser.ID,
+				PostID: source.ID,
+				ReadAt: time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to mark post as read: %w", err)
+			}
+		}
+	}
+	if len(posts) == limit {
+		if cursor := filter.nextCursor(posts); cursor != "" {
+			fmt.Printf("More posts available, continue with --cursor %s\n", cursor)
+		}
+	}
+	return nil
+}
+
+func handlerSearch(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	all := flags.Bool("all", false, "search every feed, not just followed ones")
+	limit := flags.Int("limit", 10, "maximum number of results")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing query argument: search [--all] [--limit <n>] <query>")
+	}
+	query := strings.Join(args, " ")
+	results, err := s.dbq.SearchPosts(context.Background(), database.SearchPostsParams{
+		Query:    query,
+		AllFeeds: *all,
+		UserID:   loggedInUser.ID,
+		Limit:    int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to search posts: %w", err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("No posts found matching '%s'\n", query)
+		return nil
+	}
+	for i, item := range results {
+		fmt.Printf("%d. \"%s\" <%s>\n", i+1, item.Title, item.Url)
+		fmt.Printf("   Feed: %s, posted at: %s\n", item.FeedName, item.PublishedAt.Time.Format(time.DateOnly))
+		fmt.Printf("   Post ID: %s\n", item.ID)
+	}
+	return nil
+}
+
+func handlerRead(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: read <post_id>")
+	}
+	postID, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a post id: %w", cmd.args[0], err)
+	}
+	err = s.dbq.MarkPostRead(context.Background(), database.MarkPostReadParams{
+		UserID: loggedInUser.ID,
+		PostID: postID,
+		ReadAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark post as read: %w", err)
+	}
+	fmt.Println("Marked post as read")
+	return nil
+}
+
+func handlerUnread(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: unread <post_id>")
+	}
+	postID, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a post id: %w", cmd.args[0], err)
+	}
+	err = s.dbq.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+		UserID: loggedInUser.ID,
+		PostID: postID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark post as unread: %w", err)
+	}
+	fmt.Println("Marked post as unread")
+	return nil
+}
+
+func handlerStar(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: star <post_id>")
+	}
+	postID, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a post id: %w", cmd.args[0], err)
+	}
+	err = s.dbq.StarPost(context.Background(), database.StarPostParams{
+		UserID:    loggedInUser.ID,
+		PostID:    postID,
+		StarredAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to star post: %w", err)
+	}
+	fmt.Println("Starred post")
+	return nil
+}
+
+func handlerUnstar(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: unstar <post_id>")
+	}
+	postID, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a post id: %w", cmd.args[0], err)
+	}
+	err = s.dbq.UnstarPost(context.Background(), database.UnstarPostParams{
+		UserID: loggedInUser.ID,
+		PostID: postID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to unstar post: %w", err)
+	}
+	fmt.Println("Unstarred post")
+	return nil
+}
+
+func handlerMarkRead(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	feedUrl := flags.String("feed", "", "only mark posts from this feed url")
+	all := flags.Bool("all", false, "mark every post in followed feeds")
+	before := flags.String("before", "", "only mark posts published before this date or relative duration, e.g. 2024-01-31 or 7d")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 || (*feedUrl == "" && !*all && *before == "") {
+		return fmt.Errorf("expected usage: markread --feed <feed_url> | --all | --before <date>")
+	}
+	params := database.MarkPostsReadParams{
+		UserID: loggedInUser.ID,
+		ReadAt: time.Now(),
+		FeedUrl: sql.NullString{
+			String: *feedUrl,
+			Valid:  *feedUrl != "",
+		},
 	}
+	if *before != "" {
+		t, err := parseTimeArg(*before)
+		if err != nil {
+			return err
+		}
+		params.Before = sql.NullTime{
+			Time:  t,
+			Valid: true,
+		}
+	}
+	count, err := s.dbq.MarkPostsRead(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("unable to mark posts as read: %w", err)
+	}
+	fmt.Printf("Marked %d posts as read\n", count)
 	return nil
 }
+
+// parseFlags parses flags that may appear anywhere among the positional
+// arguments, returning the positional arguments in order.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseTimeArg accepts an absolute date or time, or a duration such as "36h",
+// "7d" or "2w" which is taken as that long before now.
+func parseTimeArg(value string) (time.Time, error) {
+	for _, format := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		t, err := time.ParseInLocation(format, value, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	duration, err := parseDurationArg(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("argument %s not recognised as a date or duration", value)
+	}
+	return time.Now().Add(-duration), nil
+}
+
+// parseDurationArg extends time.ParseDuration with day (d) and week (w) units.
+func parseDurationArg(value string) (time.Duration, error) {
+	if len(value) > 1 {
+		unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[value[len(value)-1]]
+		if unit != 0 {
+			n, err := strconv.Atoi(value[:len(value)-1])
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
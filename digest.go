@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+func handlerDigest(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("missing digest type: digest epub|email")
+	}
+	subcommand := command{name: cmd.name + " " + cmd.args[0], args: cmd.args[1:]}
+	switch cmd.args[0] {
+	case "epub":
+		return digestEpub(s, subcommand, loggedInUser)
+	case "email":
+		return digestEmail(s, subcommand, loggedInUser)
+	default:
+		return fmt.Errorf("unknown digest type '%s': expected epub or email", cmd.args[0])
+	}
+}
+
+// digestFeed is one feed's posts in a digest.
+type digestFeed struct {
+	name  string
+	posts []database.GetUserPostsRow
+}
+
+// groupByFeed groups posts by feed, keeping the feeds in the order their
+// first post appears.
+func groupByFeed(posts []database.GetUserPostsRow) []digestFeed {
+	feeds := []digestFeed{}
+	index := map[string]int{}
+	for _, post := range posts {
+		key := post.FeedID.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(feeds)
+			index[key] = i
+			feeds = append(feeds, digestFeed{name: post.FeedName})
+		}
+		feeds[i].posts = append(feeds[i].posts, post)
+	}
+	return feeds
+}
+
+func digestEpub(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	since := flags.String("since", "24h", "include posts published within this long, e.g. 24h or 7d")
+	tag := flags.String("tag", "", "only include posts from followed feeds with this tag")
+	limit := flags.Int("limit", 200, "maximum number of posts")
+	markRead := flags.Bool("mark-read", false, "mark the included posts as read")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: digest epub [--since <duration>] [--tag <tag>] [--limit <n>] [--mark-read] <file>")
+	}
+	period, err := parseDurationArg(*since)
+	if err != nil {
+		return fmt.Errorf("unable to parse since duration: %w", err)
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("limit must be positive")
+	}
+
+	ctx := context.Background()
+	posts, err := s.dbq.GetUserPosts(ctx, database.GetUserPostsParams{
+		UserID:     loggedInUser.ID,
+		UnreadOnly: true,
+		Since:      sql.NullTime{Time: time.Now().Add(-period), Valid: true},
+		Tag:        optionalString(*tag),
+		Sort:       "feed",
+		Limit:      int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve user's posts: %w", err)
+	}
+	if len(posts) == 0 {
+		fmt.Println("No unread posts to include")
+		return nil
+	}
+
+	title := fmt.Sprintf("gator digest for %s, %s", loggedInUser.Name, time.Now().Format("2 Jan 2006"))
+	book, err := buildEpub(ctx, title, groupByFeed(posts))
+	if err != nil {
+		return err
+	}
+	err = book.write(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d posts from %d feeds to %s\n", len(posts), len(book.chapters), args[0])
+
+	if *markRead {
+		for _, post := range posts {
+			err = s.dbq.MarkPostRead(ctx, database.MarkPostReadParams{
+				UserID: loggedInUser.ID,
+				PostID: post.ID,
+				ReadAt: time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to mark post as read: %w", err)
+			}
+		}
+		fmt.Printf("Marked %d posts as read\n", len(posts))
+	}
+	return nil
+}
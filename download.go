@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+func handlerDownload(s *state, cmd command) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: download <post_id>")
+	}
+	if s.cfg.DownloadDir == "" {
+		return fmt.Errorf("no download directory configured: set 'download_dir' in ~/.gatorconfig.json")
+	}
+	postID, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a post id: %w", cmd.args[0], err)
+	}
+	post, err := s.dbq.GetPost(context.Background(), postID)
+	if err != nil {
+		return fmt.Errorf("post not found: %w", err)
+	}
+	enclosures, err := s.dbq.GetPostEnclosures(context.Background(), post.ID)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve post's enclosures: %w", err)
+	}
+	if len(enclosures) == 0 {
+		return fmt.Errorf("post '%s' has no enclosures to download", post.Title)
+	}
+	err = os.MkdirAll(s.cfg.DownloadDir, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create download directory: %w", err)
+	}
+	for _, enclosure := range enclosures {
+		if enclosure.DownloadedPath.Valid {
+			if _, err := os.Stat(enclosure.DownloadedPath.String); err == nil {
+				fmt.Printf("Already downloaded <%s> to '%s'\n", enclosure.Url, enclosure.DownloadedPath.String)
+				continue
+			}
+		}
+		destination := filepath.Join(s.cfg.DownloadDir, enclosureFileName(enclosure))
+		fmt.Printf("Downloading <%s> to '%s'\n", enclosure.Url, destination)
+		checksum, err := downloadFile(context.Background(), enclosure.Url, destination)
+		if err != nil {
+			return fmt.Errorf("unable to download enclosure: %w", err)
+		}
+		err = s.dbq.MarkEnclosureDownloaded(context.Background(), database.MarkEnclosureDownloadedParams{
+			DownloadedPath: sql.NullString{
+				String: destination,
+				Valid:  true,
+			},
+			Sha256: sql.NullString{
+				String: checksum,
+				Valid:  true,
+			},
+			DownloadedAt: sql.NullTime{
+				Time:  time.Now(),
+				Valid: true,
+			},
+			ID: enclosure.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to record download: %w", err)
+		}
+		fmt.Printf("Saved '%s' (sha256 %s)\n", destination, checksum)
+	}
+	return nil
+}
+
+// downloadFile saves the resource at fileUrl to destination, returning the
+// hex encoded SHA-256 of the completed file. Data is written to a '.part' file
+// first, and an existing '.part' file is resumed with a Range request.
+func downloadFile(ctx context.Context, fileUrl string, destination string) (string, error) {
+	partial := destination + ".part"
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", fileUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("User-Agent", "gator")
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		start, ok := contentRangeStart(response.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// Appending a range that doesn't start where the partial file
+			// ends would corrupt it, so start again from scratch
+			return restartDownload(ctx, response, fileUrl, destination)
+		}
+		fmt.Printf("Resuming from byte %d\n", offset)
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Server ignored the range request, so start again from scratch
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 && response.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			// The partial file already holds the whole resource
+			return finishDownload(partial, destination)
+		}
+		if offset == 0 {
+			// No range was requested, so the server has nothing to resume
+			return "", fmt.Errorf("unexpected response status: %s", response.Status)
+		}
+		// The partial file doesn't match the resource, so start again from
+		// scratch
+		return restartDownload(ctx, response, fileUrl, destination)
+	default:
+		return "", fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	f, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, response.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return finishDownload(partial, destination)
+}
+
+// restartDownload discards the partial file and downloads the whole resource
+// again, without a Range request.
+func restartDownload(ctx context.Context, response *http.Response, fileUrl string, destination string) (string, error) {
+	response.Body.Close()
+	err := os.Remove(destination + ".part")
+	if err != nil {
+		return "", err
+	}
+	return downloadFile(ctx, fileUrl, destination)
+}
+
+// contentRangeStart reads the first byte position from a Content-Range
+// header such as "bytes 100-199/200".
+func contentRangeStart(header string) (int64, bool) {
+	byteRange, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, false
+	}
+	first, _, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+func finishDownload(partial string, destination string) (string, error) {
+	checksum, err := hashFile(partial)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(partial, destination)
+	if err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// enclosureFileName derives a local file name from the enclosure url,
+// prefixed with the enclosure id so episodes with identical names don't clash.
+func enclosureFileName(enclosure database.PostEnclosure) string {
+	name := ""
+	if parsed, err := url.Parse(enclosure.Url); err == nil {
+		name = path.Base(parsed.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "enclosure"
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return enclosure.ID.String()[:8] + "-" + name
+}
+
+func describeEnclosure(enclosure database.PostEnclosure) string {
+	details := []string{}
+	if enclosure.MimeType != "" {
+		details = append(details, enclosure.MimeType)
+	}
+	if enclosure.Length > 0 {
+		details = append(details, fmt.Sprintf("%.1f MB", float64(enclosure.Length)/(1024*1024)))
+	}
+	if enclosure.Duration != "" {
+		details = append(details, "duration "+enclosure.Duration)
+	}
+	if enclosure.Episode != "" {
+		details = append(details, "episode "+enclosure.Episode)
+	}
+	if enclosure.DownloadedPath.Valid {
+		details = append(details, "downloaded to '"+enclosure.DownloadedPath.String+"'")
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(details, ", ") + ")"
+}
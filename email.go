@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+//go:embed templates/digest_email.html templates/digest_email.txt
+var digestEmailTemplates embed.FS
+
+var (
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.ParseFS(digestEmailTemplates, "templates/digest_email.html"))
+	digestTextTemplate = texttemplate.Must(texttemplate.ParseFS(digestEmailTemplates, "templates/digest_email.txt"))
+)
+
+// How often each digest frequency is sent.
+var digestPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+const (
+	// A digest counts as due this long before its period is up, so one sent
+	// by agg isn't pushed back a whole interval by a slightly early tick
+	digestSlack = 5 * time.Minute
+	// Posts beyond this many are left for a follow-up email
+	maxDigestPosts = 200
+	// Excerpts are cut to about this many characters
+	digestExcerptLength = 280
+	// A mail server that stops responding gives up after this long, so it
+	// can't hold up the aggregator
+	smtpTimeout = 30 * time.Second
+)
+
+// emailDigest is the data for the digest email templates.
+type emailDigest struct {
+	Title string
+	Since time.Time
+	Count int
+	Feeds []emailDigestFeed
+}
+
+type emailDigestFeed struct {
+	Name  string
+	Posts []emailDigestPost
+}
+
+type emailDigestPost struct {
+	Title     string
+	Url       string
+	Author    string
+	Published time.Time
+	Excerpt   string
+}
+
+func digestEmail(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("missing subcommand: digest email subscribe|unsubscribe|send")
+	}
+	subcommand := command{name: cmd.name + " " + cmd.args[0], args: cmd.args[1:]}
+	switch cmd.args[0] {
+	case "subscribe":
+		return subscribeDigest(s, subcommand, loggedInUser)
+	case "unsubscribe":
+		return unsubscribeDigest(s, subcommand, loggedInUser)
+	case "send":
+		return sendDigestsCommand(s, subcommand, loggedInUser)
+	default:
+		return fmt.Errorf("unknown subcommand '%s': expected subscribe, unsubscribe or send", cmd.args[0])
+	}
+}
+
+func subscribeDigest(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	weekly := flags.Bool("weekly", false, "send the digest weekly instead of daily")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: digest email subscribe [--weekly] <address>")
+	}
+	address, err := mail.ParseAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid email address: %w", err)
+	}
+	frequency := "daily"
+	if *weekly {
+		frequency = "weekly"
+	}
+	err = s.dbq.SetUserDigest(context.Background(), database.SetUserDigestParams{
+		Email:           sql.NullString{String: address.Address, Valid: true},
+		DigestFrequency: frequency,
+		UpdatedAt:       time.Now(),
+		ID:              loggedInUser.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update user: %w", err)
+	}
+	fmt.Printf("Sending a %s digest to %s\n", frequency, address.Address)
+	return nil
+}
+
+func unsubscribeDigest(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 0 {
+		return fmt.Errorf("too many arguments: digest email unsubscribe")
+	}
+	err := s.dbq.SetUserDigest(context.Background(), database.SetUserDigestParams{
+		Email:           loggedInUser.Email,
+		DigestFrequency: "off",
+		UpdatedAt:       time.Now(),
+		ID:              loggedInUser.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update user: %w", err)
+	}
+	fmt.Println("Email digest turned off")
+	return nil
+}
+
+func sendDigestsCommand(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	now := flags.Bool("now", false, "send your own digest now, whether or not it is due")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("too many arguments: digest email send [--now]")
+	}
+	if !*now {
+		sent, err := sendDueDigests(context.Background(), s)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sent %d digests\n", sent)
+		return nil
+	}
+	if loggedInUser.DigestFrequency == "off" || !loggedInUser.Email.Valid {
+		return fmt.Errorf("no email digest set up: run 'digest email subscribe <address>' first")
+	}
+	count, err := sendDigest(context.Background(), s, loggedInUser, time.Now())
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Println("No new posts to send")
+		return nil
+	}
+	fmt.Printf("Sent %d posts to %s\n", count, loggedInUser.Email.String)
+	return nil
+}
+
+// sendDueDigests sends the digest of every subscriber whose period is up,
+// returning how many emails were sent.
+func sendDueDigests(ctx context.Context, s *state) (int, error) {
+	users, err := s.dbq.GetDigestSubscribers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to retrieve digest subscribers: %w", err)
+	}
+	now := time.Now()
+	sent := 0
+	for _, user := range users {
+		period, ok := digestPeriods[user.DigestFrequency]
+		if !ok {
+			continue
+		}
+		if user.LastDigestAt.Valid && now.Before(user.LastDigestAt.Time.Add(period-digestSlack)) {
+			continue
+		}
+		count, err := sendDigest(ctx, s, user, now)
+		if err != nil {
+			// One bad address shouldn't hold up everyone else's digest
+			fmt.Printf("Unable to send digest to %s: %s\n", user.Name, err)
+			continue
+		}
+		if count > 0 {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendDigest emails the user the posts that arrived since their last digest
+// and records them, so no post is sent twice. It returns the number of posts
+// sent; when there are none no email is sent.
+func sendDigest(ctx context.Context, s *state, user database.User, now time.Time) (int, error) {
+	if s.cfg.SMTPHost == "" || s.cfg.SMTPFrom == "" {
+		return 0, fmt.Errorf("smtp_host and smtp_from must be set in the config file")
+	}
+	since := now.Add(-digestPeriods[user.DigestFrequency])
+	if user.LastDigestAt.Valid {
+		since = user.LastDigestAt.Time
+	}
+	posts, err := s.dbq.GetDigestPosts(ctx, database.GetDigestPostsParams{
+		UserID: user.ID,
+		Since:  since,
+		Limit:  maxDigestPosts,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to retrieve digest posts: %w", err)
+	}
+
+	if len(posts) > 0 {
+		digest := emailDigest{
+			Title: fmt.Sprintf("gator digest for %s, %s", user.Name, now.Format("2 Jan 2006")),
+			Since: since,
+			Count: len(posts),
+			Feeds: groupDigestPosts(posts),
+		}
+		message, err := digestMessage(s, user.Email.String, digest)
+		if err != nil {
+			return 0, err
+		}
+		err = sendMail(s, user.Email.String, message)
+		if err != nil {
+			return 0, err
+		}
+		ids := make([]uuid.UUID, 0, len(posts))
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+		err = s.dbq.RecordDigestPosts(ctx, database.RecordDigestPostsParams{
+			UserID:  user.ID,
+			PostIds: ids,
+			SentAt:  now,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to record digest posts: %w", err)
+		}
+	}
+	if len(posts) == maxDigestPosts {
+		// Leave the digest due, so the rest of the posts follow in another
+		// email. Posts already sent are recorded and won't be sent again.
+		return len(posts), nil
+	}
+	err = s.dbq.SetUserLastDigest(ctx, database.SetUserLastDigestParams{
+		LastDigestAt: sql.NullTime{Time: now, Valid: true},
+		ID:           user.ID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to update user: %w", err)
+	}
+	return len(posts), nil
+}
+
+// groupDigestPosts groups posts by feed. The posts arrive sorted by feed
+// name, then feed.
+func groupDigestPosts(posts []database.GetDigestPostsRow) []emailDigestFeed {
+	feeds := []emailDigestFeed{}
+	for i, post := range posts {
+		if i == 0 || post.FeedID != posts[i-1].FeedID {
+			feeds = append(feeds, emailDigestFeed{Name: post.FeedName})
+		}
+		published := post.CreatedAt
+		if post.PublishedAt.Valid {
+			published = post.PublishedAt.Time
+		}
+		feed := &feeds[len(feeds)-1]
+		feed.Posts = append(feed.Posts, emailDigestPost{
+			Title:     post.Title,
+			Url:       post.Url,
+			Author:    post.Author,
+			Published: published,
+			Excerpt:   excerpt(htmlText(postBody(post.Description, post.Content)), digestExcerptLength),
+		})
+	}
+	return feeds
+}
+
+// excerpt shortens text to at most length characters, cutting at a word
+// boundary.
+func excerpt(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	cut := string([]rune(text)[:length])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// digestMessage renders the digest as a multipart/alternative email with
+// plain text and HTML versions.
+func digestMessage(s *state, to string, digest emailDigest) ([]byte, error) {
+	from, err := mail.ParseAddress(s.cfg.SMTPFrom)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse smtp_from: %w", err)
+	}
+	var text, html bytes.Buffer
+	err = digestTextTemplate.Execute(&text, digest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render digest: %w", err)
+	}
+	err = digestHTMLTemplate.Execute(&html, digest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render digest: %w", err)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		// Clients show the last alternative they support, so HTML goes last
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to write email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write(part.content)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write email: %w", err)
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to write email: %w", err)
+		}
+	}
+	err = parts.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to write email: %w", err)
+	}
+
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", (&mail.Address{Address: to}).String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", digest.Title))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@%s>\r\n", uuid.New(), domain)
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n", parts.Boundary())
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// sendMail delivers a message through the configured mail server, using
+// STARTTLS when the server offers it. It works like smtp.SendMail, but gives
+// up on a server that stops responding.
+func sendMail(s *state, to string, message []byte) error {
+	from, err := mail.ParseAddress(s.cfg.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("unable to parse smtp_from: %w", err)
+	}
+	port := s.cfg.SMTPPort
+	if port == 0 {
+		port = 25
+	}
+	addr := net.JoinHostPort(s.cfg.SMTPHost, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	if err != nil {
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+	err = deliverMail(conn, s, from.Address, to, message)
+	if err != nil {
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+	return nil
+}
+
+func deliverMail(conn net.Conn, s *state, from, to string, message []byte) error {
+	client, err := smtp.NewClient(conn, s.cfg.SMTPHost)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: s.cfg.SMTPHost})
+		if err != nil {
+			return err
+		}
+	}
+	if s.cfg.SMTPUsername != "" {
+		err = client.Auth(smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, s.cfg.SMTPHost))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jthughes/gatorcli/internal/config"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts every message, like a
+// local MailHog.
+type smtpStandIn struct {
+	listener net.Listener
+	messages chan smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &smtpStandIn{listener: listener, messages: make(chan smtpMessage, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP stand-in")
+	message := smtpMessage{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.to = append(message.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			message.data = data.String()
+			server.messages <- message
+			message = smtpMessage{}
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSendDigestEmail(t *testing.T) {
+	server := startSMTPStandIn(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	s := &state{cfg: &config.Config{
+		SMTPHost: host,
+		SMTPPort: portNumber,
+		SMTPFrom: "gator <gator@example.com>",
+	}}
+	published := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	digest := emailDigest{
+		Title: "gator digest for alice, 1 May 2024",
+		Since: published.Add(-24 * time.Hour),
+		Count: 1,
+		Feeds: []emailDigestFeed{{
+			Name: "Café News",
+			Posts: []emailDigestPost{{
+				Title:     "Espresso & you",
+				Url:       "https://example.com/espresso",
+				Published: published,
+				Excerpt:   "All about coffee.",
+			}},
+		}},
+	}
+
+	message, err := digestMessage(s, "alice@example.com", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sendMail(s, "alice@example.com", message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received smtpMessage
+	select {
+	case received = <-server.messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	if received.from != "gator@example.com" || len(received.to) != 1 || received.to[0] != "alice@example.com" {
+		t.Fatalf("unexpected envelope: from %q to %q", received.from, received.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(received.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != digest.Title {
+		t.Errorf("subject = %q, want %q", subject, digest.Title)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q", parsed.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	bodies := map[string]string{}
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		// NextPart decodes quoted-printable itself and drops the header
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[partType] = string(data)
+	}
+	for _, partType := range []string{"text/plain", "text/html"} {
+		body, ok := bodies[partType]
+		if !ok {
+			t.Errorf("missing %s part", partType)
+			continue
+		}
+		for _, want := range []string{"Café News", "https://example.com/espresso", "All about coffee."} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s part doesn't contain %q", partType, want)
+			}
+		}
+	}
+	if !strings.Contains(bodies["text/html"], "Espresso &amp; you") {
+		t.Errorf("HTML part doesn't escape the post title")
+	}
+}
+
+func TestSendMailRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	// Nothing is listening once the port is closed
+	listener.Close()
+	portNumber, _ := strconv.Atoi(port)
+	s := &state{cfg: &config.Config{SMTPHost: host, SMTPPort: portNumber, SMTPFrom: "gator@example.com"}}
+	err = sendMail(s, "alice@example.com", []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil {
+		t.Fatal("expected an error sending to a closed port")
+	}
+}
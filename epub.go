@@ -0,0 +1,412 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// Images larger than this are left out of EPUB digests.
+	maxEpubImageBytes = 5 << 20
+	epubImageTimeout  = 30 * time.Second
+	// Images still missing after this long are left out, so a digest with
+	// many slow images doesn't take forever
+	epubImagesDeadline = 2 * time.Minute
+	epubImageWorkers   = 8
+)
+
+// Image types EPUB readers are required to support, with their extensions.
+var epubImageTypes = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+}
+
+const epubStylesheet = `body { font-family: serif; line-height: 1.4; }
+h1 { page-break-before: always; }
+.meta { color: #555; font-size: 0.85em; }
+img { max-width: 100%; height: auto; }
+pre { white-space: pre-wrap; }
+`
+
+type epubBook struct {
+	id       string
+	title    string
+	chapters []epubChapter
+	images   []epubImage
+	// Embedded images by source url, so repeated images are stored once
+	imagesByUrl map[string]string
+}
+
+// epubChapter holds one feed's posts.
+type epubChapter struct {
+	file  string
+	title string
+	posts []epubPost
+}
+
+type epubPost struct {
+	anchor string
+	title  string
+	body   string
+}
+
+type epubImage struct {
+	file      string
+	mediaType string
+	data      []byte
+}
+
+// epubBody is a post body parsed ahead of rendering, so that every image in
+// the book can be fetched together.
+type epubBody struct {
+	nodes []*nethtml.Node
+	// Used when the body can't be parsed
+	fallback string
+}
+
+// buildEpub renders the digest's posts as XHTML chapters, one per feed,
+// downloading their images so the book can be read offline.
+func buildEpub(ctx context.Context, title string, feeds []digestFeed) (*epubBook, error) {
+	book := &epubBook{
+		id:          "urn:uuid:" + uuid.New().String(),
+		title:       title,
+		imagesByUrl: map[string]string{},
+	}
+	bodies := [][]epubBody{}
+	sources := []string{}
+	for _, feed := range feeds {
+		feedBodies := []epubBody{}
+		for _, post := range feed.posts {
+			body, postSources := parseEpubBody(postBody(post.Description, post.Content), post.Url)
+			feedBodies = append(feedBodies, body)
+			sources = append(sources, postSources...)
+		}
+		bodies = append(bodies, feedBodies)
+	}
+	book.embedImages(ctx, sources)
+
+	for i, feed := range feeds {
+		chapter := epubChapter{
+			file:  fmt.Sprintf("feed-%d.xhtml", i+1),
+			title: feed.name,
+		}
+		for j, post := range feed.posts {
+			var body strings.Builder
+			fmt.Fprintf(&body, `<p class="meta"><a href="%s">%s</a>`, html.EscapeString(post.Url), html.EscapeString(postTime(post).Format("2 Jan 2006 15:04")))
+			if post.Author != "" {
+				fmt.Fprintf(&body, " · %s", html.EscapeString(post.Author))
+			}
+			body.WriteString("</p>\n")
+			content, err := book.xhtmlBody(bodies[i][j])
+			if err != nil {
+				return nil, err
+			}
+			body.WriteString(content)
+			chapter.posts = append(chapter.posts, epubPost{
+				anchor: fmt.Sprintf("post-%d", j+1),
+				title:  post.Title,
+				body:   body.String(),
+			})
+		}
+		book.chapters = append(book.chapters, chapter)
+	}
+	return book, nil
+}
+
+// parseEpubBody sanitizes a post body, resolving its links against the
+// post's url, and returns it with the sources of its images.
+func parseEpubBody(body string, postUrl string) (epubBody, []string) {
+	nodes, err := parseHTMLFragment(sanitizeHTML(body))
+	if err != nil {
+		return epubBody{fallback: html.EscapeString(body)}, nil
+	}
+	sources := []string{}
+	base, err := url.Parse(postUrl)
+	for _, n := range nodes {
+		if err == nil {
+			resolveLinks(n, base)
+		}
+		sources = append(sources, imageSources(n)...)
+	}
+	return epubBody{nodes: nodes}, sources
+}
+
+func imageSources(n *nethtml.Node) []string {
+	sources := []string{}
+	if n.Type == nethtml.ElementNode && n.DataAtom == atom.Img {
+		sources = append(sources, getAttr(n, "src"))
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sources = append(sources, imageSources(c)...)
+	}
+	return sources
+}
+
+// xhtmlBody re-serializes a parsed body as well-formed XHTML, pointing its
+// images at their embedded copies.
+func (book *epubBook) xhtmlBody(body epubBody) (string, error) {
+	if body.nodes == nil {
+		return body.fallback, nil
+	}
+	var out strings.Builder
+	for _, n := range body.nodes {
+		err := nethtml.Render(&out, book.replaceImage(n))
+		if err != nil {
+			return "", fmt.Errorf("unable to render post body: %w", err)
+		}
+	}
+	return out.String(), nil
+}
+
+// replaceImage points an image at its embedded copy, or replaces it with its
+// alt text when there is none, as readers can't load remote images. Other
+// nodes have their images replaced and are returned as they are.
+func (book *epubBook) replaceImage(n *nethtml.Node) *nethtml.Node {
+	if n.Type == nethtml.ElementNode && n.DataAtom == atom.Img {
+		file, ok := book.imagesByUrl[getAttr(n, "src")]
+		if !ok {
+			return &nethtml.Node{Type: nethtml.TextNode, Data: getAttr(n, "alt")}
+		}
+		for i := range n.Attr {
+			if n.Attr[i].Key == "src" {
+				n.Attr[i].Val = file
+			}
+		}
+		return n
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if replacement := book.replaceImage(c); replacement != c {
+			n.InsertBefore(replacement, c)
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+	return n
+}
+
+// embedImages downloads the images a few at a time, adding the ones that
+// arrive before the deadline to the book. Images that fail are skipped.
+func (book *epubBook) embedImages(ctx context.Context, sources []string) {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, src := range sources {
+		if !seen[src] && (strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")) {
+			seen[src] = true
+			unique = append(unique, src)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, epubImagesDeadline)
+	defer cancel()
+
+	images := make([]*epubImage, len(unique))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(epubImageWorkers, len(unique)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				image, err := fetchEpubImage(ctx, unique[i])
+				if err == nil {
+					images[i] = &image
+				}
+			}
+		}()
+	}
+	for i := range unique {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// Files are numbered in the order images appear in the book
+	for i, image := range images {
+		if image == nil {
+			continue
+		}
+		image.file = fmt.Sprintf("images/image-%d%s", len(book.images)+1, epubImageTypes[image.mediaType])
+		book.images = append(book.images, *image)
+		book.imagesByUrl[unique[i]] = image.file
+	}
+}
+
+func fetchEpubImage(ctx context.Context, src string) (epubImage, error) {
+	ctx, cancel := context.WithTimeout(ctx, epubImageTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+	if err != nil {
+		return epubImage{}, err
+	}
+	request.Header.Set("User-Agent", "gator")
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return epubImage{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return epubImage{}, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if _, ok := epubImageTypes[mediaType]; !ok {
+		return epubImage{}, fmt.Errorf("unsupported image type %s", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxEpubImageBytes+1))
+	if err != nil {
+		return epubImage{}, err
+	}
+	if len(data) > maxEpubImageBytes {
+		return epubImage{}, fmt.Errorf("image too large")
+	}
+	return epubImage{mediaType: mediaType, data: data}, nil
+}
+
+type epubFile struct {
+	name string
+	data []byte
+}
+
+// write saves the book as an EPUB 3 container.
+func (book *epubBook) write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create EPUB file: %w", err)
+	}
+	defer f.Close()
+
+	archive := zip.NewWriter(f)
+	// The mimetype must come first and be stored uncompressed
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("unable to write EPUB file: %w", err)
+	}
+	_, err = io.WriteString(w, "application/epub+zip")
+	if err != nil {
+		return fmt.Errorf("unable to write EPUB file: %w", err)
+	}
+
+	files := []epubFile{
+		{"META-INF/container.xml", []byte(epubContainer)},
+		{"OEBPS/content.opf", []byte(book.packageDocument())},
+		{"OEBPS/nav.xhtml", []byte(book.navDocument())},
+		{"OEBPS/style.css", []byte(epubStylesheet)},
+	}
+	for _, chapter := range book.chapters {
+		files = append(files, epubFile{"OEBPS/" + chapter.file, []byte(chapter.document())})
+	}
+	for _, image := range book.images {
+		files = append(files, epubFile{"OEBPS/" + image.file, image.data})
+	}
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("unable to write EPUB file: %w", err)
+		}
+		_, err = w.Write(file.data)
+		if err != nil {
+			return fmt.Errorf("unable to write EPUB file: %w", err)
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write EPUB file: %w", err)
+	}
+	return f.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func (book *epubBook) packageDocument() string {
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&out, "    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", html.EscapeString(book.id))
+	fmt.Fprintf(&out, "    <dc:title>%s</dc:title>\n", html.EscapeString(book.title))
+	out.WriteString("    <dc:language>en</dc:language>\n")
+	out.WriteString("    <dc:creator>gator</dc:creator>\n")
+	fmt.Fprintf(&out, "    <meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	out.WriteString("  </metadata>\n  <manifest>\n")
+	out.WriteString("    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	out.WriteString("    <item id=\"style\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	for i, chapter := range book.chapters {
+		fmt.Fprintf(&out, "    <item id=\"feed-%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, chapter.file)
+	}
+	for i, image := range book.images {
+		fmt.Fprintf(&out, "    <item id=\"image-%d\" href=\"%s\" media-type=\"%s\"/>\n", i+1, image.file, image.mediaType)
+	}
+	out.WriteString("  </manifest>\n  <spine>\n    <itemref idref=\"nav\"/>\n")
+	for i := range book.chapters {
+		fmt.Fprintf(&out, "    <itemref idref=\"feed-%d\"/>\n", i+1)
+	}
+	out.WriteString("  </spine>\n</package>\n")
+	return out.String()
+}
+
+// navDocument is the table of contents: each feed, with its posts nested
+// under it.
+func (book *epubBook) navDocument() string {
+	var out strings.Builder
+	out.WriteString(epubXHTMLHeader(book.title))
+	out.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n")
+	fmt.Fprintf(&out, "<h1>%s</h1>\n<ol>\n", html.EscapeString(book.title))
+	for _, chapter := range book.chapters {
+		fmt.Fprintf(&out, "<li><a href=\"%s\">%s</a>\n<ol>\n", chapter.file, html.EscapeString(chapter.title))
+		for _, post := range chapter.posts {
+			fmt.Fprintf(&out, "<li><a href=\"%s#%s\">%s</a></li>\n", chapter.file, post.anchor, html.EscapeString(post.title))
+		}
+		out.WriteString("</ol>\n</li>\n")
+	}
+	out.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return out.String()
+}
+
+func (chapter epubChapter) document() string {
+	var out strings.Builder
+	out.WriteString(epubXHTMLHeader(chapter.title))
+	fmt.Fprintf(&out, "<h1>%s</h1>\n", html.EscapeString(chapter.title))
+	for _, post := range chapter.posts {
+		fmt.Fprintf(&out, "<section id=\"%s\">\n<h2>%s</h2>\n%s\n</section>\n", post.anchor, html.EscapeString(post.title), post.body)
+	}
+	out.WriteString("</body>\n</html>\n")
+	return out.String()
+}
+
+func epubXHTMLHeader(title string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="en" xml:lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>%s</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+`, html.EscapeString(title))
+}
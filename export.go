@@ -0,0 +1,611 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+func handlerExport(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("missing export type: export starred|posts|opml|feed")
+	}
+	subcommand := command{name: cmd.name + " " + cmd.args[0], args: cmd.args[1:]}
+	switch cmd.args[0] {
+	case "starred":
+		return exportStarred(s, subcommand, loggedInUser)
+	case "posts":
+		return exportPosts(s, subcommand, loggedInUser)
+	case "opml":
+		return exportOPML(s, subcommand, loggedInUser)
+	case "feed":
+		return exportFeed(s, subcommand, loggedInUser)
+	default:
+		return fmt.Errorf("unknown export type '%s': expected starred, posts, opml or feed", cmd.args[0])
+	}
+}
+
+// openOutput returns the named file for writing, or stdout when no file is
+// given.
+func openOutput(args []string) (io.WriteCloser, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := os.Create(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to create output file: %w", err)
+	}
+	return f, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+type exportedPost struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Url         string     `json:"url"`
+	Feed        string     `json:"feed"`
+	Author      string     `json:"author,omitempty"`
+	Categories  []string   `json:"categories,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	FetchedAt   *time.Time `json:"fetched_at,omitempty"`
+	StarredAt   *time.Time `json:"starred_at,omitempty"`
+	Description string     `json:"description"`
+	Content     string     `json:"content,omitempty"`
+}
+
+func exportStarred(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	format := flags.String("format", "md", "output format: md or json")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments: export starred [--format md|json] [<file>]")
+	}
+	if *format != "md" && *format != "json" {
+		return fmt.Errorf("unknown format '%s': expected md or json", *format)
+	}
+	posts, err := s.dbq.GetStarredPosts(context.Background(), loggedInUser.ID)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve starred posts: %w", err)
+	}
+
+	out, err := openOutput(args)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if *format == "json" {
+		exported := []exportedPost{}
+		for _, post := range posts {
+			item := exportedPost{
+				ID:          post.ID.String(),
+				Title:       post.Title,
+				Url:         post.Url,
+				Feed:        post.FeedName,
+				StarredAt:   &post.StarredAt,
+				Description: post.Description,
+				Content:     post.Content.String,
+			}
+			if post.PublishedAt.Valid {
+				item.PublishedAt = &post.PublishedAt.Time
+			}
+			exported = append(exported, item)
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(exported)
+	}
+
+	fmt.Fprintf(out, "# Starred posts for %s\n", loggedInUser.Name)
+	for _, post := range posts {
+		fmt.Fprintf(out, "\n## [%s](%s)\n\n", markdownEscape(post.Title), post.Url)
+		fmt.Fprintf(out, "*%s*", markdownEscape(post.FeedName))
+		if post.PublishedAt.Valid {
+			fmt.Fprintf(out, " · published %s", post.PublishedAt.Time.Format(time.DateOnly))
+		}
+		fmt.Fprintf(out, " · starred %s\n\n", post.StarredAt.Format(time.DateOnly))
+		body := renderText(postBody(post.Description, post.Content), 80)
+		if body != "" {
+			fmt.Fprintln(out, body)
+		}
+	}
+	return nil
+}
+
+// exportPosts writes the posts browse would show, either as a single stream
+// or, with --dir, as one file per post.
+func exportPosts(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	filter := addPostFilterFlags(flags)
+	format := flags.String("format", "md", "output format: md, json or csv")
+	limit := flags.Int("limit", 100, "maximum number of posts")
+	dir := flags.String("dir", "", "write one file per post into this directory instead of a single stream")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments: export posts [flags] [--format md|json|csv] [--limit <n>] [--dir <dir> | <file>]")
+	}
+	switch *format {
+	case "md", "json", "csv":
+	default:
+		return fmt.Errorf("unknown format '%s': expected md, json or csv", *format)
+	}
+	if *dir != "" && len(args) > 0 {
+		return fmt.Errorf("--dir and an output file can't be used together")
+	}
+	if *dir != "" && *format == "csv" {
+		return fmt.Errorf("csv can only be written as a single stream")
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("limit must be positive")
+	}
+	params, err := filter.params(loggedInUser.ID, *limit)
+	if err != nil {
+		return err
+	}
+	rows, err := s.dbq.GetUserPosts(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve user's posts: %w", err)
+	}
+	posts := []exportedPost{}
+	for _, row := range rows {
+		categories, err := s.dbq.GetPostCategories(context.Background(), row.ID)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve post's categories: %w", err)
+		}
+		post := exportedPost{
+			ID:          row.ID.String(),
+			Title:       row.Title,
+			Url:         row.Url,
+			Feed:        row.FeedName,
+			Author:      row.Author,
+			Categories:  categories,
+			FetchedAt:   &row.CreatedAt,
+			Description: row.Description,
+			Content:     row.Content.String,
+		}
+		if row.PublishedAt.Valid && !row.PublishedAt.Time.IsZero() {
+			post.PublishedAt = &row.PublishedAt.Time
+		}
+		posts = append(posts, post)
+	}
+
+	if *dir != "" {
+		err = os.MkdirAll(*dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("unable to create output directory: %w", err)
+		}
+		for _, post := range posts {
+			err = writePostFile(*dir, post, *format)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Exported %d posts to %s\n", len(posts), *dir)
+		return nil
+	}
+
+	out, err := openOutput(args)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(posts)
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.Write([]string{"id", "title", "url", "feed", "author", "categories", "published_at", "fetched_at", "body"})
+		for _, post := range posts {
+			published := ""
+			if post.PublishedAt != nil {
+				published = post.PublishedAt.Format(time.RFC3339)
+			}
+			writer.Write([]string{
+				post.ID,
+				post.Title,
+				post.Url,
+				post.Feed,
+				post.Author,
+				strings.Join(post.Categories, ";"),
+				published,
+				post.FetchedAt.Format(time.RFC3339),
+				htmlText(postBody(post.Description, optionalString(post.Content))),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		for i, post := range posts {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			err = writeMarkdownPost(out, post)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writePostFile writes a post to its own file, named after its date and
+// title, with the post id keeping names unique.
+func writePostFile(dir string, post exportedPost, format string) error {
+	date := post.FetchedAt
+	if post.PublishedAt != nil {
+		date = post.PublishedAt
+	}
+	name := fmt.Sprintf("%s-%s-%s.%s", date.Format(time.DateOnly), fileSlug(post.Title), post.ID[:8], format)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("unable to create post file: %w", err)
+	}
+	defer f.Close()
+	if format == "json" {
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(post)
+	} else {
+		err = writeMarkdownPost(f, post)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write post file: %w", err)
+	}
+	return f.Close()
+}
+
+// writeMarkdownPost writes a post as Markdown with YAML front matter. Values
+// are written as JSON strings, which YAML reads as double-quoted scalars.
+func writeMarkdownPost(out io.Writer, post exportedPost) error {
+	quote := func(value string) string {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", quote(post.ID))
+	fmt.Fprintf(&b, "title: %s\n", quote(post.Title))
+	fmt.Fprintf(&b, "url: %s\n", quote(post.Url))
+	fmt.Fprintf(&b, "feed: %s\n", quote(post.Feed))
+	if post.Author != "" {
+		fmt.Fprintf(&b, "author: %s\n", quote(post.Author))
+	}
+	if len(post.Categories) > 0 {
+		categories, _ := json.Marshal(post.Categories)
+		fmt.Fprintf(&b, "categories: %s\n", categories)
+	}
+	if post.PublishedAt != nil {
+		fmt.Fprintf(&b, "published: %s\n", post.PublishedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "fetched: %s\n", post.FetchedAt.Format(time.RFC3339))
+	b.WriteString("---\n\n")
+	fmt.Fprintf(&b, "# [%s](%s)\n", markdownEscape(post.Title), post.Url)
+	body := renderText(postBody(post.Description, optionalString(post.Content)), 80)
+	if body != "" {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// exportOPML writes a user's follows as OPML 2.0, with each tag as a folder.
+// Feeds with several tags appear in each of their folders, which import
+// merges back together.
+func exportOPML(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	userName := flags.String("user", loggedInUser.Name, "export this user's follows instead of the current user's")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments: export opml [--user <name>] [<file>]")
+	}
+	user, err := s.dbq.GetUser(context.Background(), *userName)
+	if err != nil {
+		return fmt.Errorf("user '%s' not found: %w", *userName, err)
+	}
+	follows, err := s.dbq.GetFollowingWithTags(context.Background(), user.Name)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve followed feeds: %w", err)
+	}
+
+	var opml OPML
+	opml.Version = "2.0"
+	opml.Head.Title = fmt.Sprintf("Feeds followed by %s", user.Name)
+	opml.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+	opml.Head.OwnerName = user.Name
+	folders := map[string]int{}
+	for _, follow := range follows {
+		text := follow.FeedName
+		if follow.DisplayTitle.Valid {
+			text = follow.DisplayTitle.String
+		}
+		title := follow.FeedTitle
+		if title == "" {
+			title = text
+		}
+		outline := OPMLOutline{
+			Text:    text,
+			Title:   title,
+			Type:    "rss",
+			XMLUrl:  follow.FeedUrl,
+			HTMLUrl: follow.SiteLink,
+		}
+		if !follow.Tag.Valid {
+			opml.Body.Outlines = append(opml.Body.Outlines, outline)
+			continue
+		}
+		i, ok := folders[follow.Tag.String]
+		if !ok {
+			i = len(opml.Body.Outlines)
+			folders[follow.Tag.String] = i
+			opml.Body.Outlines = append(opml.Body.Outlines, OPMLOutline{Text: follow.Tag.String})
+		}
+		opml.Body.Outlines[i].Outlines = append(opml.Body.Outlines[i].Outlines, outline)
+	}
+
+	out, err := openOutput(args)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	data, err := xml.MarshalIndent(opml, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode OPML: %w", err)
+	}
+	_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// Feed documents written by export feed. Only the elements gator has data
+// for are included.
+type rssDocument struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	AtomNS  string   `xml:"xmlns:atom,attr"`
+	DCNS    string   `xml:"xmlns:dc,attr"`
+	Channel rssChannel
+}
+
+type rssChannel struct {
+	XMLName       xml.Name     `xml:"channel"`
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Description   string       `xml:"description"`
+	Generator     string       `xml:"generator"`
+	LastBuildDate string       `xml:"lastBuildDate"`
+	SelfLink      *atomLink    `xml:"atom:link,omitempty"`
+	Items         []rssOutItem `xml:"item"`
+}
+
+type rssOutItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        rssGuid  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []atomLink     `xml:"link"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// exportFeed renders the user's timeline, as GetUserPosts returns it, as an
+// RSS 2.0 or Atom document that other readers can subscribe to.
+func exportFeed(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	format := flags.String("format", "rss", "output format: rss or atom")
+	tag := flags.String("tag", "", "only include posts from followed feeds with this tag")
+	limit := flags.Int("limit", 50, "maximum number of posts")
+	link := flags.String("link", "", "url the feed will be published at")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments: export feed [--format rss|atom] [--tag <tag>] [--limit <n>] [--link <url>] [<file>]")
+	}
+	if *format != "rss" && *format != "atom" {
+		return fmt.Errorf("unknown format '%s': expected rss or atom", *format)
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("limit must be positive")
+	}
+	if *format == "rss" && *link == "" {
+		// RSS 2.0 channels must have a link
+		return fmt.Errorf("--link is required for RSS output: give the url the feed will be published at")
+	}
+	// The exported feed is a river of everything, so read state doesn't
+	// matter here
+	posts, err := s.dbq.GetUserPosts(context.Background(), database.GetUserPostsParams{
+		UserID: loggedInUser.ID,
+		Tag:    optionalString(*tag),
+		Sort:   "published",
+		Limit:  int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve user's posts: %w", err)
+	}
+
+	title := fmt.Sprintf("%s's timeline", loggedInUser.Name)
+	if *tag != "" {
+		title = fmt.Sprintf("%s's %s timeline", loggedInUser.Name, *tag)
+	}
+	var document any
+	if *format == "rss" {
+		document, err = timelineRSS(s, posts, title, *link)
+	} else {
+		document, err = timelineAtom(s, posts, title, *link, loggedInUser)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(args)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode feed: %w", err)
+	}
+	_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, data)
+	return err
+}
+
+func timelineRSS(s *state, posts []database.GetUserPostsRow, title, link string) (rssDocument, error) {
+	document := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          link,
+			Description:   "Posts collected by gator",
+			Generator:     "gator",
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+			Items:         []rssOutItem{},
+		},
+	}
+	if link != "" {
+		document.Channel.SelfLink = &atomLink{Href: link, Rel: "self", Type: "application/rss+xml"}
+	}
+	for _, post := range posts {
+		categories, err := s.dbq.GetPostCategories(context.Background(), post.ID)
+		if err != nil {
+			return document, fmt.Errorf("unable to retrieve post's categories: %w", err)
+		}
+		document.Channel.Items = append(document.Channel.Items, rssOutItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			Guid:        rssGuid{Value: "urn:uuid:" + post.ID.String()},
+			PubDate:     postTime(post).Format(time.RFC1123Z),
+			Creator:     post.Author,
+			Categories:  categories,
+			Description: sanitizeHTML(postBody(post.Description, post.Content)),
+		})
+	}
+	return document, nil
+}
+
+func timelineAtom(s *state, posts []database.GetUserPostsRow, title, link string, loggedInUser database.User) (atomFeed, error) {
+	feed := atomFeed{
+		Title:   title,
+		ID:      "urn:uuid:" + loggedInUser.ID.String(),
+		Updated: time.Now().Format(time.RFC3339),
+		Author:  atomPerson{Name: loggedInUser.Name},
+		Entries: []atomEntry{},
+	}
+	if link != "" {
+		feed.Links = append(feed.Links, atomLink{Href: link, Rel: "self", Type: "application/atom+xml"})
+	}
+	for _, post := range posts {
+		categories, err := s.dbq.GetPostCategories(context.Background(), post.ID)
+		if err != nil {
+			return feed, fmt.Errorf("unable to retrieve post's categories: %w", err)
+		}
+		entry := atomEntry{
+			Title:     post.Title,
+			ID:        "urn:uuid:" + post.ID.String(),
+			Updated:   post.UpdatedAt.Format(time.RFC3339),
+			Published: postTime(post).Format(time.RFC3339),
+			Links:     []atomLink{{Href: post.Url, Rel: "alternate", Type: "text/html"}},
+		}
+		if post.Author != "" {
+			entry.Author = &atomPerson{Name: post.Author}
+		}
+		for _, category := range categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		if post.Description != "" {
+			entry.Summary = &atomText{Type: "html", Value: sanitizeHTML(post.Description)}
+		}
+		if post.Content.Valid && post.Content.String != "" {
+			entry.Content = &atomText{Type: "html", Value: sanitizeHTML(post.Content.String)}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
+
+// postTime returns when a post was published, or when it was fetched for
+// posts without a usable publish date.
+func postTime(post database.GetUserPostsRow) time.Time {
+	if post.PublishedAt.Valid && !post.PublishedAt.Time.IsZero() {
+		return post.PublishedAt.Time
+	}
+	return post.CreatedAt
+}
+
+func markdownEscape(text string) string {
+	return strings.NewReplacer(`[`, `\[`, `]`, `\]`, `*`, `\*`, `_`, `\_`).Replace(text)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// Pages larger than this are not worth extracting an article from.
+	maxArticleBytes = 5 << 20
+	// A slow site shouldn't hold up collecting every other feed
+	articleTimeout = 30 * time.Second
+)
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)comment|sidebar|footer|footnote|nav|menu|share|social|related|advert|promo|sponsor|cookie|banner|popup|subscribe|newsletter|breadcrumb|pagination`)
+	likelyCandidates   = regexp.MustCompile(`(?i)article|content|main|post|body|entry|story|text`)
+)
+
+// postBody returns the full article content when one has been stored,
+// falling back to the feed-provided description.
+func postBody(description string, content sql.NullString) string {
+	if content.Valid && strings.TrimSpace(content.String) != "" {
+		return content.String
+	}
+	return description
+}
+
+// extractArticle downloads the page at pageUrl and returns the sanitized HTML
+// of its main content, found with a simplified readability-style scoring of
+// paragraph-holding elements.
+func extractArticle(ctx context.Context, pageUrl string) (string, error) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, articleTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "GET", pageUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("User-Agent", "gator")
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	doc, err := html.Parse(io.LimitReader(response.Body, maxArticleBytes))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse page: %w", err)
+	}
+
+	article := findMainContent(doc)
+	if article == nil {
+		return "", fmt.Errorf("no article content found")
+	}
+	resolveLinks(article, base)
+	var out strings.Builder
+	for c := article.FirstChild; c != nil; c = c.NextSibling {
+		writeSanitized(&out, c)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+func findMainContent(doc *html.Node) *html.Node {
+	removeUnlikelyNodes(doc)
+
+	scores := map[*html.Node]float64{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Td) {
+			text := nodeText(n)
+			if len(text) >= 25 && n.Parent != nil {
+				score := 1 + float64(strings.Count(text, ","))
+				score += min(float64(len(text))/100, 3)
+				addCandidateScore(scores, n.Parent, score)
+				if n.Parent.Parent != nil {
+					addCandidateScore(scores, n.Parent.Parent, score/2)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	// Go through the candidates in document order rather than map order, so
+	// a tie always goes to the first one
+	var best *html.Node
+	bestScore := 0.0
+	var pick func(n *html.Node)
+	pick = func(n *html.Node) {
+		if score, ok := scores[n]; ok {
+			// Penalise candidates that are mostly links, such as link lists
+			score *= 1 - linkDensity(n)
+			if best == nil || score > bestScore {
+				best = n
+				bestScore = score
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			pick(c)
+		}
+	}
+	pick(doc)
+	return best
+}
+
+func addCandidateScore(scores map[*html.Node]float64, n *html.Node, score float64) {
+	if _, ok := scores[n]; !ok {
+		scores[n] = initialCandidateScore(n)
+	}
+	scores[n] += score
+}
+
+func initialCandidateScore(n *html.Node) float64 {
+	score := 0.0
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		score += 10
+	case atom.Div:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Form, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+	hint := getAttr(n, "class") + " " + getAttr(n, "id")
+	if likelyCandidates.MatchString(hint) {
+		score += 25
+	}
+	if unlikelyCandidates.MatchString(hint) {
+		score -= 25
+	}
+	return score
+}
+
+// removeUnlikelyNodes strips page chrome (navigation, comments, sharing
+// widgets and so on) before scoring.
+func removeUnlikelyNodes(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			hint := getAttr(c, "class") + " " + getAttr(c, "id")
+			unlikely := unlikelyCandidates.MatchString(hint) && !likelyCandidates.MatchString(hint)
+			switch {
+			case droppedElements[c.DataAtom], c.DataAtom == atom.Nav, c.DataAtom == atom.Aside:
+				n.RemoveChild(c)
+			case unlikely && c.DataAtom != atom.Body && c.DataAtom != atom.Html:
+				n.RemoveChild(c)
+			default:
+				removeUnlikelyNodes(c)
+			}
+		}
+		c = next
+	}
+}
+
+func nodeText(n *html.Node) string {
+	var out strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			out.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(out.String()), " ")
+}
+
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			linked += len(nodeText(n))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(linked) / float64(total)
+}
+
+// resolveLinks rewrites relative href and src attributes against the page url
+// so the stored article still works offline or when published elsewhere.
+func resolveLinks(n *html.Node, base *url.URL) {
+	if n.Type == html.ElementNode {
+		for i, attr := range n.Attr {
+			if attr.Key != "href" && attr.Key != "src" {
+				continue
+			}
+			ref, err := url.Parse(strings.TrimSpace(attr.Val))
+			if err != nil {
+				continue
+			}
+			n.Attr[i].Val = base.ResolveReference(ref).String()
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		resolveLinks(c, base)
+	}
+}
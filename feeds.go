@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,18 +20,93 @@ import (
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title string `xml:"title"`
+		// atom:link elements must be matched before the plain link field,
+		// otherwise they overwrite the channel's site link.
+		AtomLinks   []RSSAtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Link        string        `xml:"link"`
+		Description string        `xml:"description"`
+		Language    string        `xml:"language"`
+		Generator   string        `xml:"generator"`
+		Image       struct {
+			Url   string `xml:"url"`
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+		} `xml:"image"`
+		Item []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
+type RSSAtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Author      string         `xml:"author"`
+	Categories  []string       `xml:"category"`
+	// FeedBurner records the article's real link alongside its proxy link
+	OrigLink string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+	// iTunes podcast namespace tags
+	Duration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Episode  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	Image    struct {
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	// Media RSS namespace tags
+	MediaGroups     []RSSMediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	MediaContents   []RSSMediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnails []RSSMediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type RSSEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Atom feeds are read into the same RSSFeed and RSSItem shape as RSS ones.
+type AtomFeed struct {
+	Title     string        `xml:"http://www.w3.org/2005/Atom title"`
+	Subtitle  string        `xml:"http://www.w3.org/2005/Atom subtitle"`
+	Links     []RSSAtomLink `xml:"http://www.w3.org/2005/Atom link"`
+	Generator string        `xml:"http://www.w3.org/2005/Atom generator"`
+	Logo      string        `xml:"http://www.w3.org/2005/Atom logo"`
+	Icon      string        `xml:"http://www.w3.org/2005/Atom icon"`
+	Language  string        `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Entries   []AtomEntry   `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type AtomEntry struct {
+	Title     string        `xml:"http://www.w3.org/2005/Atom title"`
+	Links     []RSSAtomLink `xml:"http://www.w3.org/2005/Atom link"`
+	Published string        `xml:"http://www.w3.org/2005/Atom published"`
+	Updated   string        `xml:"http://www.w3.org/2005/Atom updated"`
+	Summary   string        `xml:"http://www.w3.org/2005/Atom summary"`
+	Content   struct {
+		Type string `xml:"type,attr"`
+		Text string `xml:",chardata"`
+		XML  string `xml:",innerxml"`
+	} `xml:"http://www.w3.org/2005/Atom content"`
+	Authors []struct {
+		Name string `xml:"http://www.w3.org/2005/Atom name"`
+	} `xml:"http://www.w3.org/2005/Atom author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"http://www.w3.org/2005/Atom category"`
+	// Media RSS namespace tags, as used by YouTube
+	MediaGroups     []RSSMediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	MediaContents   []RSSMediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnails []RSSMediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
 }
 
 func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
@@ -43,14 +122,37 @@ func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
 	data, err := io.ReadAll(response.Body)
 	if err != nil {
 		return nil, err
 	}
-	var feed RSSFeed
-	err = xml.Unmarshal(data, &feed)
+	feed, err := parseFeed(data)
 	if err != nil {
-		return nil, fmt.Errorf("unable to unmarshal data")
+		return nil, err
+	}
+	// WebSub hubs may be advertised in Link headers instead of the feed
+	feed.Channel.AtomLinks = append(feed.Channel.AtomLinks, parseLinkHeader(response.Header.Values("Link"))...)
+	return feed, nil
+}
+
+func parseFeed(data []byte) (*RSSFeed, error) {
+	var feed RSSFeed
+	if isAtomFeed(data) {
+		var atom AtomFeed
+		err := xml.Unmarshal(data, &atom)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal data")
+		}
+		feed = atom.toRSS()
+	} else {
+		err := xml.Unmarshal(data, &feed)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal data")
+		}
 	}
 
 	// Unescape values from the HTML
@@ -63,19 +165,117 @@ func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
 	return &feed, nil
 }
 
+// isAtomFeed reports whether the document's root element is an Atom feed.
+func isAtomFeed(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Space == "http://www.w3.org/2005/Atom" && start.Name.Local == "feed"
+		}
+	}
+}
+
+func (atom AtomFeed) toRSS() RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = atom.Title
+	feed.Channel.Description = atom.Subtitle
+	feed.Channel.Link = atomLinkHref(atom.Links, "alternate")
+	feed.Channel.AtomLinks = atom.Links
+	feed.Channel.Language = atom.Language
+	feed.Channel.Generator = atom.Generator
+	feed.Channel.Image.Url = atom.Logo
+	if feed.Channel.Image.Url == "" {
+		feed.Channel.Image.Url = atom.Icon
+	}
+	for _, entry := range atom.Entries {
+		item := RSSItem{
+			Title:           entry.Title,
+			Link:            atomLinkHref(entry.Links, "alternate"),
+			Description:     entry.Summary,
+			PubDate:         entry.Published,
+			MediaGroups:     entry.MediaGroups,
+			MediaContents:   entry.MediaContents,
+			MediaThumbnails: entry.MediaThumbnails,
+		}
+		if item.PubDate == "" {
+			item.PubDate = entry.Updated
+		}
+		if entry.Content.Type == "xhtml" {
+			item.Content = strings.TrimSpace(entry.Content.XML)
+		} else {
+			item.Content = strings.TrimSpace(entry.Content.Text)
+		}
+		if item.Description == "" {
+			// YouTube only describes videos in the media:group
+			for _, group := range entry.MediaGroups {
+				if group.Description != "" {
+					item.Description = group.Description
+					break
+				}
+			}
+		}
+		for _, author := range entry.Authors {
+			if name := strings.TrimSpace(author.Name); name != "" {
+				item.Creator = name
+				break
+			}
+		}
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Term)
+		}
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" {
+				item.Enclosures = append(item.Enclosures, RSSEnclosure{
+					Url:    link.Href,
+					Length: link.Length,
+					Type:   link.Type,
+				})
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, item)
+	}
+	return feed
+}
+
+// atomLinkHref returns the href of the first link with the relation, where a
+// missing rel means alternate.
+func atomLinkHref(links []RSSAtomLink, rel string) string {
+	for _, link := range links {
+		linkRel := link.Rel
+		if linkRel == "" {
+			linkRel = "alternate"
+		}
+		if linkRel == rel {
+			return link.Href
+		}
+	}
+	return ""
+}
+
 func scrapeFeeds(ctx context.Context, s *state) error {
-	oldestFeedUrl := ""
+	// Feeds leave the queue once a hub leases them, so the pass ends when a
+	// feed comes round again rather than when the first one does
+	visited := map[uuid.UUID]bool{}
 	for {
-		feedEntry, err := s.dbq.GetNextFeedToFetch(ctx)
+		feedEntry, err := s.dbq.GetNextFeedToFetch(ctx, database.GetNextFeedToFetchParams{
+			Now:       time.Now(),
+			PollAfter: time.Now().Add(-websubPollInterval),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Every feed is being pushed by a WebSub hub
+			return nil
+		}
 		if err != nil {
 			return fmt.Errorf("unable to fetch next feed: %w", err)
 		}
-		if oldestFeedUrl == feedEntry.Url {
+		if visited[feedEntry.ID] {
 			return nil
 		}
-		if oldestFeedUrl == "" {
-			oldestFeedUrl = feedEntry.Url
-		}
+		visited[feedEntry.ID] = true
 		err = s.dbq.MarkFeedFetch(ctx, database.MarkFeedFetchParams{
 			LastFetchedAt: sql.NullTime{
 				Time:  time.Now(),
@@ -88,15 +288,67 @@ func scrapeFeeds(ctx context.Context, s *state) error {
 		}
 		feed, err := fetchFeed(ctx, feedEntry.Url)
 		if err != nil {
-			return fmt.Errorf("unable to fetch feed from url: %w", err)
+			// Record the failure and move on, so one broken feed doesn't
+			// stop the rest from being collected
+			fmt.Printf("Unable to fetch %s from <%s>: %s\n", feedEntry.Name, feedEntry.Url, err)
+			err = s.dbq.SetFeedFetchStatus(ctx, database.SetFeedFetchStatusParams{
+				LastFetchStatus: sql.NullString{
+					String: "error: " + err.Error(),
+					Valid:  true,
+				},
+				UpdatedAt: time.Now(),
+				ID:        feedEntry.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to record feed fetch status: %w", err)
+			}
+			continue
+		}
+		err = s.dbq.UpdateFeedMetadata(ctx, database.UpdateFeedMetadataParams{
+			Title:       feed.Channel.Title,
+			Description: feed.Channel.Description,
+			SiteLink:    feed.Channel.Link,
+			Language:    feed.Channel.Language,
+			ImageUrl:    feed.Channel.Image.Url,
+			Generator:   feed.Channel.Generator,
+			LastFetchStatus: sql.NullString{
+				String: "ok",
+				Valid:  true,
+			},
+			UpdatedAt: time.Now(),
+			ID:        feedEntry.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to update feed metadata: %w", err)
 		}
 		fmt.Printf("Fetching %s from <%s>\n", feedEntry.Name, feedEntry.Url)
+		if s.websub != nil {
+			err = s.websub.discover(ctx, s, feedEntry, feed)
+			if err != nil {
+				fmt.Printf("Unable to subscribe to %s with WebSub: %s\n", feedEntry.Name, err)
+			}
+		}
 		for _, item := range feed.Channel.Item {
 			err = addPost(item, feedEntry, ctx, s)
 			if err == nil {
 				fmt.Printf("Found post: %s (published '%s')\n", item.Title, item.PubDate)
 			}
 		}
+		if len(feed.Channel.Item) > 0 {
+			// Pruned posts only need remembering while they are still in the
+			// feed
+			links := make([]string, 0, len(feed.Channel.Item))
+			for _, item := range feed.Channel.Item {
+				links = append(links, item.Link)
+			}
+			err = s.dbq.ForgetPrunedPosts(ctx, database.ForgetPrunedPostsParams{
+				FeedID:      feedEntry.ID,
+				CurrentUrls: links,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to forget pruned posts: %w", err)
+			}
+		}
 
 	}
 }
@@ -137,21 +389,159 @@ func addPost(post RSSItem, feedEntry database.Feed, ctx context.Context, s *stat
 		}
 	}
 
-	_, err := s.dbq.CreatePost(ctx, database.CreatePostParams{
-		ID:          uuid.New(),
+	// Skip posts that are already stored before doing any work on them, as
+	// canonicalizing a link may need a request to a redirector
+	exists, err := s.dbq.PostExists(ctx, database.PostExistsParams{
+		FeedID:      feedEntry.ID,
+		OriginalUrl: post.Link,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to check for existing post: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("post <%s> already stored", post.Link)
+	}
+
+	link := post.Link
+	if strings.TrimSpace(post.OrigLink) != "" {
+		link = post.OrigLink
+	}
+	canonicalUrl := newURLCanonicalizer(s).canonicalize(ctx, link)
+
+	// Fetch the full article before the transaction starts, so it isn't held
+	// open during a slow request
+	article := sql.NullString{}
+	if feedEntry.FetchFullContent && post.Content == "" && canonicalUrl != "" {
+		content, err := extractArticle(ctx, canonicalUrl)
+		if err != nil {
+			// The teaser is still stored, so carry on without the full article
+			fmt.Printf("Unable to fetch full content for <%s>: %s\n", canonicalUrl, err)
+		} else {
+			article = sql.NullString{String: content, Valid: true}
+		}
+	}
+
+	// Store the post and everything found on it together, as a post that is
+	// only partly stored would be skipped as existing on every later fetch
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.dbq.WithTx(tx)
+
+	postID := uuid.New()
+	newPost, err := qtx.CreatePost(ctx, database.CreatePostParams{
+		ID:          postID,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 		Title:       post.Title,
-		Url:         post.Link,
+		Url:         canonicalUrl,
 		Description: post.Description,
 		PublishedAt: sql.NullTime{
 			Time:  published_time,
 			Valid: true,
 		},
 		FeedID: feedEntry.ID,
+		Content: sql.NullString{
+			String: post.Content,
+			Valid:  post.Content != "",
+		},
+		Author:        postAuthor(post),
+		NormalizedUrl: normalizeURL(canonicalUrl),
+		Simhash:       simhash(post.Title, postBody(post.Description, sql.NullString{String: post.Content, Valid: true})),
+		ClusterID:     postID,
+		OriginalUrl:   post.Link,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to add new post to database: %w", err)
 	}
-	return nil
+	err = assignCluster(newPost, ctx, qtx)
+	if err != nil {
+		return err
+	}
+
+	for _, category := range post.Categories {
+		category = strings.TrimSpace(category)
+		if category == "" {
+			continue
+		}
+		err = qtx.CreatePostCategory(ctx, database.CreatePostCategoryParams{
+			PostID:   newPost.ID,
+			Category: category,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add category to database: %w", err)
+		}
+	}
+
+	body := postBody(post.Description, newPost.Content)
+	if article.Valid {
+		err = qtx.UpdatePostContent(ctx, database.UpdatePostContentParams{
+			Content: sql.NullString{
+				String: article.String,
+				Valid:  article.String != "",
+			},
+			UpdatedAt: time.Now(),
+			ID:        newPost.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to store full content: %w", err)
+		}
+		body = postBody(post.Description, article)
+	}
+
+	err = applyRules(post, newPost.ID, body, feedEntry, ctx, qtx)
+	if err != nil {
+		return err
+	}
+
+	for _, enclosure := range post.Enclosures {
+		if enclosure.Url == "" {
+			continue
+		}
+		// Length is frequently missing or malformed, so fall back to 0 (unknown)
+		length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		_, err = qtx.CreatePostEnclosure(ctx, database.CreatePostEnclosureParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			PostID:    newPost.ID,
+			Url:       enclosure.Url,
+			MimeType:  enclosure.Type,
+			Length:    length,
+			Duration:  post.Duration,
+			Episode:   post.Episode,
+			ImageUrl:  post.Image.Href,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add enclosure to database: %w", err)
+		}
+	}
+	err = addPostMedia(post, newPost.ID, ctx, qtx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unable to commit post: %w", err)
+	}
+
+	// Notify once everything about the post is stored. The post is already
+	// saved, so a failing hook mustn't stop the webhooks being called
+	err = runNewPostHook(post, newPost, body, feedEntry, ctx, s)
+	if err != nil {
+		fmt.Printf("Unable to run on_new_post hook for \"%s\": %s\n", newPost.Title, err)
+	}
+	return notifyWebhooks(post, newPost, body, feedEntry, ctx, s)
+}
+
+// postAuthor prefers dc:creator, which is a plain name, over RSS's author
+// element, which is meant to be an email address.
+func postAuthor(post RSSItem) string {
+	if creator := strings.TrimSpace(post.Creator); creator != "" {
+		return creator
+	}
+	return strings.TrimSpace(post.Author)
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+// postFilter holds the flags shared by every command that lists a user's
+// posts through GetUserPosts.
+type postFilter struct {
+	all         *bool
+	starred     *bool
+	highlighted *bool
+	feed        *string
+	since       *string
+	until       *string
+	author      *string
+	category    *string
+	tag         *string
+	sort        *string
+	offset      *int
+	cursor      *string
+}
+
+func addPostFilterFlags(flags *flag.FlagSet) *postFilter {
+	return &postFilter{
+		all:         flags.Bool("all", false, "include posts that have already been read"),
+		starred:     flags.Bool("starred", false, "only show starred posts, read or unread"),
+		highlighted: flags.Bool("highlighted", false, "only show posts matched by a highlight rule"),
+		feed:        flags.String("feed", "", "only show posts from the feed with this url or name"),
+		since:       flags.String("since", "", "only show posts published since this date or relative duration, e.g. 2024-01-31 or 7d"),
+		until:       flags.String("until", "", "only show posts published before this date or relative duration"),
+		author:      flags.String("author", "", "only show posts whose author contains this text"),
+		category:    flags.String("category", "", "only show posts in this category"),
+		tag:         flags.String("tag", "", "only show posts from followed feeds with this tag"),
+		sort:        flags.String("sort", "published", "sort order: published, fetched or feed"),
+		offset:      flags.Int("offset", 0, "skip this many posts"),
+		cursor:      flags.String("cursor", "", "continue from the cursor printed after a previous page"),
+	}
+}
+
+func (f *postFilter) params(userID uuid.UUID, limit int) (database.GetUserPostsParams, error) {
+	params := database.GetUserPostsParams{
+		UserID:          userID,
+		UnreadOnly:      !*f.all && !*f.starred,
+		StarredOnly:     *f.starred,
+		HighlightedOnly: *f.highlighted,
+		Feed:            optionalString(*f.feed),
+		Author:          optionalString(*f.author),
+		Category:        optionalString(*f.category),
+		Tag:             optionalString(*f.tag),
+		Sort:            *f.sort,
+		Limit:           int32(limit),
+		Offset:          int32(*f.offset),
+	}
+	switch *f.sort {
+	case "published", "fetched", "feed":
+	default:
+		return params, fmt.Errorf("unknown sort '%s': expected published, fetched or feed", *f.sort)
+	}
+	if *f.offset < 0 {
+		return params, fmt.Errorf("offset must not be negative")
+	}
+	if *f.since != "" {
+		t, err := parseTimeArg(*f.since)
+		if err != nil {
+			return params, err
+		}
+		params.Since = sql.NullTime{Time: t, Valid: true}
+	}
+	if *f.until != "" {
+		t, err := parseTimeArg(*f.until)
+		if err != nil {
+			return params, err
+		}
+		params.Until = sql.NullTime{Time: t, Valid: true}
+	}
+	if *f.cursor != "" {
+		if *f.sort == "feed" {
+			return params, fmt.Errorf("cursor paging is not supported with --sort feed, use --offset instead")
+		}
+		t, id, err := decodeCursor(*f.cursor)
+		if err != nil {
+			return params, err
+		}
+		params.CursorTime = sql.NullTime{Time: t, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	return params, nil
+}
+
+// nextCursor returns the cursor that continues after the last post of a page,
+// or "" when the sort order doesn't support cursors.
+func (f *postFilter) nextCursor(posts []database.GetUserPostsRow) string {
+	if len(posts) == 0 || *f.sort == "feed" {
+		return ""
+	}
+	last := posts[len(posts)-1]
+	t := last.PublishedAt.Time
+	if *f.sort == "fetched" {
+		t = last.CreatedAt
+	}
+	return encodeCursor(t, last.ID)
+}
+
+// encodeCursor stores the time as seconds and nanoseconds, as posts with an
+// unparsable date have the zero time, which UnixNano can't represent.
+func encodeCursor(t time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%09d:%s", t.Unix(), t.Nanosecond(), id)))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	invalid := fmt.Errorf("cursor %s not recognised", cursor)
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, invalid
+	}
+	timeText, idText, found := strings.Cut(string(data), ":")
+	if !found {
+		return time.Time{}, uuid.UUID{}, invalid
+	}
+	secondsText, nanosText, found := strings.Cut(timeText, ".")
+	if !found {
+		return time.Time{}, uuid.UUID{}, invalid
+	}
+	seconds, err := strconv.ParseInt(secondsText, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, invalid
+	}
+	nanos, err := strconv.ParseInt(nanosText, 10, 64)
+	if err != nil || nanos < 0 || nanos >= int64(time.Second) {
+		return time.Time{}, uuid.UUID{}, invalid
+	}
+	id, err := uuid.Parse(idText)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, invalid
+	}
+	// Timestamps are stored without a zone, so compare them as UTC wall times
+	return time.Unix(seconds, nanos).UTC(), id, nil
+}
+
+func optionalString(value string) sql.NullString {
+	return sql.NullString{
+		String: value,
+		Valid:  value != "",
+	}
+}
@@ -3,6 +3,10 @@ module github.com/jthughes/gatorcli
 go 1.23.4
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.33.0
+	golang.org/x/term v0.27.0
 )
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+const (
+	defaultHookTimeout       = 30 * time.Second
+	defaultHookMaxConcurrent = 4
+	// Hook output is only shown when the hook fails, cut to this length
+	maxHookOutput = 2000
+	// Hooks waiting beyond this many are skipped
+	hookQueueSize = 1000
+)
+
+// hookRunner runs the configured hooks for the current user on a fixed
+// number of workers, with a bounded queue of hooks waiting to run.
+type hookRunner struct {
+	onNewPost string
+	timeout   time.Duration
+	workers   int
+	user      database.User
+	ctx       context.Context
+	cancel    context.CancelFunc
+	queue     chan hookRun
+	wg        sync.WaitGroup
+	// Guards queue against sends once it is closed
+	mu     sync.Mutex
+	closed bool
+}
+
+type hookRun struct {
+	path  string
+	input []byte
+	env   []string
+	title string
+}
+
+// hookPayload is the JSON written to a hook's stdin.
+type hookPayload struct {
+	Event        string        `json:"event"`
+	User         string        `json:"user"`
+	Feed         webhookFeed   `json:"feed"`
+	Post         webhookPost   `json:"post"`
+	MatchedRules []webhookRule `json:"matched_rules"`
+}
+
+// configHookRunner starts the runner for the hooks in the config file, or
+// returns nil if none are set.
+func configHookRunner(ctx context.Context, s *state) (*hookRunner, error) {
+	if s.cfg.Hooks == nil || s.cfg.Hooks.OnNewPost == "" {
+		return nil, nil
+	}
+	path, err := exec.LookPath(s.cfg.Hooks.OnNewPost)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find on_new_post hook: %w", err)
+	}
+	runner := &hookRunner{
+		onNewPost: path,
+		timeout:   defaultHookTimeout,
+		workers:   defaultHookMaxConcurrent,
+	}
+	if s.cfg.Hooks.Timeout != "" {
+		runner.timeout, err = parseDurationArg(s.cfg.Hooks.Timeout)
+		if err != nil || runner.timeout <= 0 {
+			return nil, fmt.Errorf("unable to parse hooks timeout '%s': expected a duration such as 30s", s.cfg.Hooks.Timeout)
+		}
+	}
+	if s.cfg.Hooks.MaxConcurrent > 0 {
+		runner.workers = s.cfg.Hooks.MaxConcurrent
+	}
+	// Hooks are the current user's, so they only run for posts the user
+	// would see
+	runner.user, err = s.dbq.GetUser(ctx, s.cfg.Username)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find current user for hooks: %w", err)
+	}
+
+	runner.ctx, runner.cancel = context.WithCancel(context.Background())
+	runner.queue = make(chan hookRun, hookQueueSize)
+	for range runner.workers {
+		runner.wg.Add(1)
+		go func() {
+			defer runner.wg.Done()
+			for hook := range runner.queue {
+				runner.runQueued(hook)
+			}
+		}()
+	}
+	return runner, nil
+}
+
+// enqueue queues a hook to run. When the queue is full, or the runner has
+// stopped, the hook is skipped instead.
+func (runner *hookRunner) enqueue(hook hookRun) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.closed {
+		runner.skip(hook, "aggregator stopped")
+		return
+	}
+	select {
+	case runner.queue <- hook:
+	default:
+		runner.skip(hook, "too many hooks waiting")
+	}
+}
+
+func (runner *hookRunner) runQueued(hook hookRun) {
+	if runner.ctx.Err() != nil {
+		runner.skip(hook, "aggregator stopped")
+		return
+	}
+	err := runner.run(hook.path, hook.input, hook.env)
+	if err != nil {
+		fmt.Printf("on_new_post hook failed for \"%s\": %s\n", hook.title, err)
+	}
+}
+
+func (runner *hookRunner) skip(hook hookRun, reason string) {
+	fmt.Printf("on_new_post hook not run for \"%s\": %s\n", hook.title, reason)
+}
+
+// stop kills hooks that are running, reports the ones still waiting as not
+// run and waits for the workers to finish.
+func (runner *hookRunner) stop() {
+	runner.mu.Lock()
+	runner.closed = true
+	close(runner.queue)
+	runner.mu.Unlock()
+	runner.cancel()
+	runner.wg.Wait()
+}
+
+// runNewPostHook queues the on_new_post hook for a post from one of the
+// user's followed, unmuted feeds. The hook runs in the background once a
+// worker is free.
+func runNewPostHook(post RSSItem, newPost database.Post, body string, feedEntry database.Feed, ctx context.Context, s *state) error {
+	if s.hooks == nil {
+		return nil
+	}
+	visible, err := s.dbq.PostVisibleToUser(ctx, database.PostVisibleToUserParams{
+		UserID: s.hooks.user.ID,
+		FeedID: feedEntry.ID,
+		PostID: newPost.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to check post for hooks: %w", err)
+	}
+	if !visible {
+		return nil
+	}
+	rules, err := s.dbq.GetMatchedRules(ctx, database.GetMatchedRulesParams{
+		PostID: newPost.ID,
+		UserID: s.hooks.user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve matched rules: %w", err)
+	}
+	payload := hookPayload{
+		Event:        webhookEventNewPost,
+		User:         s.hooks.user.Name,
+		Feed:         newWebhookFeed(feedEntry),
+		Post:         newWebhookPost(post, newPost, body),
+		MatchedRules: newWebhookRules(rules),
+	}
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("unable to encode hook payload: %w", err)
+	}
+
+	published := ""
+	if payload.Post.PublishedAt != nil {
+		published = payload.Post.PublishedAt.Format(time.RFC3339)
+	}
+	highlighted := "false"
+	for _, rule := range rules {
+		if rule.Action == ruleActionHighlight {
+			highlighted = "true"
+		}
+	}
+	env := []string{
+		"GATOR_EVENT=" + payload.Event,
+		"GATOR_USER=" + payload.User,
+		"GATOR_FEED_NAME=" + feedEntry.Name,
+		"GATOR_FEED_URL=" + feedEntry.Url,
+		"GATOR_POST_ID=" + newPost.ID.String(),
+		"GATOR_POST_TITLE=" + newPost.Title,
+		"GATOR_POST_URL=" + newPost.Url,
+		"GATOR_POST_AUTHOR=" + newPost.Author,
+		"GATOR_POST_PUBLISHED_AT=" + published,
+		"GATOR_POST_HIGHLIGHTED=" + highlighted,
+	}
+	s.hooks.enqueue(hookRun{
+		path:  s.hooks.onNewPost,
+		input: input,
+		env:   env,
+		title: newPost.Title,
+	})
+	return nil
+}
+
+// run executes a hook with input on stdin and env added to gator's own
+// environment, killing it if it runs longer than the timeout.
+func (runner *hookRunner) run(path string, input []byte, env []string) error {
+	ctx, cancel := context.WithTimeout(runner.ctx, runner.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), env...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait on pipes held open by processes the hook started
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if runner.ctx.Err() != nil {
+		return fmt.Errorf("killed as the aggregator stopped")
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", runner.timeout)
+	}
+	if err != nil {
+		text := strings.TrimSpace(output.String())
+		if len(text) > maxHookOutput {
+			text = text[:maxHookOutput] + "…"
+		}
+		if text != "" {
+			return fmt.Errorf("%w: %s", err, text)
+		}
+		return err
+	}
+	return nil
+}
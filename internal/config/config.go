@@ -12,8 +12,39 @@ const (
 )
 
 type Config struct {
-	Username string `json:"current_user_name"`
-	DBUrl    string `json:"db_url"`
+	Username    string `json:"current_user_name"`
+	DBUrl       string `json:"db_url"`
+	DownloadDir string `json:"download_dir,omitempty"`
+	// Extra query parameters (a trailing * matches any suffix) and
+	// link-shortener hosts, on top of gator's built-in lists
+	StripParams     []string `json:"strip_params,omitempty"`
+	RedirectorHosts []string `json:"redirector_hosts,omitempty"`
+	// Default retention policy for prune, overridable per feed
+	RetentionMaxAge     string `json:"retention_max_age,omitempty"`
+	RetentionMaxPosts   int    `json:"retention_max_posts,omitempty"`
+	RetentionKeepUnread string `json:"retention_keep_unread,omitempty"`
+	// Mail server for email digests. No authentication is attempted when
+	// smtp_username is empty.
+	SMTPHost     string `json:"smtp_host,omitempty"`
+	SMTPPort     int    `json:"smtp_port,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+	SMTPFrom     string `json:"smtp_from,omitempty"`
+	Hooks        *Hooks `json:"hooks,omitempty"`
+	// Public url of agg's WebSub callback server, and the address it listens
+	// on. WebSub is off unless the url is set.
+	WebSubCallbackURL string `json:"websub_callback_url,omitempty"`
+	WebSubListen      string `json:"websub_listen,omitempty"`
+}
+
+// Hooks are local executables run by the aggregator.
+type Hooks struct {
+	// Run for each new post, with the post as JSON on stdin
+	OnNewPost string `json:"on_new_post,omitempty"`
+	// How long a hook may run before it is killed, e.g. "30s"
+	Timeout string `json:"timeout,omitempty"`
+	// How many hooks may run at once
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
 }
 
 func Read() Config {
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,10 +23,10 @@ WITH inserted_feed_follow AS (
         $4,
         $5
     )
-    RETURNING id, created_at, updated_at, user_id, feed_id
+    RETURNING id, created_at, updated_at, user_id, feed_id, display_title, muted, notify
 )
 SELECT
-    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id,
+    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id, inserted_feed_follow.display_title, inserted_feed_follow.muted, inserted_feed_follow.notify,
     feeds.name AS feed_name,
     users.name AS user_name
 FROM inserted_feed_follow
@@ -42,13 +43,16 @@ type CreateFeedFollowParams struct {
 }
 
 type CreateFeedFollowRow struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	UserID    uuid.UUID
-	FeedID    uuid.UUID
-	FeedName  string
-	UserName  string
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	FeedID       uuid.UUID
+	DisplayTitle sql.NullString
+	Muted        bool
+	Notify       string
+	FeedName     string
+	UserName     string
 }
 
 func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowParams) (CreateFeedFollowRow, error) {
@@ -66,15 +70,45 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.DisplayTitle,
+		&i.Muted,
+		&i.Notify,
 		&i.FeedName,
 		&i.UserName,
 	)
 	return i, err
 }
 
+const getFeedFollow = `-- name: GetFeedFollow :one
+SELECT feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feed_follows.display_title, feed_follows.muted, feed_follows.notify FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1 AND feeds.url = $2
+`
+
+type GetFeedFollowParams struct {
+	UserID uuid.UUID
+	Url    string
+}
+
+func (q *Queries) GetFeedFollow(ctx context.Context, arg GetFeedFollowParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedFollow, arg.UserID, arg.Url)
+	var i FeedFollow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.FeedID,
+		&i.DisplayTitle,
+		&i.Muted,
+		&i.Notify,
+	)
+	return i, err
+}
+
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 SELECT
-    feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, 
+    feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feed_follows.display_title, feed_follows.muted, feed_follows.notify, 
     users.name AS user_name,
     feeds.name AS feed_name 
 FROM feed_follows
@@ -84,13 +118,16 @@ WHERE users.name = $1
 `
 
 type GetFeedFollowsForUserRow struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	UserID    uuid.UUID
-	FeedID    uuid.UUID
-	UserName  string
-	FeedName  string
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	FeedID       uuid.UUID
+	DisplayTitle sql.NullString
+	Muted        bool
+	Notify       string
+	UserName     string
+	FeedName     string
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]GetFeedFollowsForUserRow, error) {
@@ -108,6 +145,9 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]Get
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.DisplayTitle,
+			&i.Muted,
+			&i.Notify,
 			&i.UserName,
 			&i.FeedName,
 		); err != nil {
@@ -141,3 +181,28 @@ func (q *Queries) UnfollowFeed(ctx context.Context, arg UnfollowFeedParams) erro
 	_, err := q.db.ExecContext(ctx, unfollowFeed, arg.Name, arg.Url)
 	return err
 }
+
+const updateFeedFollowSettings = `-- name: UpdateFeedFollowSettings :exec
+UPDATE feed_follows
+SET display_title = $1, muted = $2, notify = $3, updated_at = $4
+WHERE id = $5
+`
+
+type UpdateFeedFollowSettingsParams struct {
+	DisplayTitle sql.NullString
+	Muted        bool
+	Notify       string
+	UpdatedAt    time.Time
+	ID           uuid.UUID
+}
+
+func (q *Queries) UpdateFeedFollowSettings(ctx context.Context, arg UpdateFeedFollowSettingsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedFollowSettings,
+		arg.DisplayTitle,
+		arg.Muted,
+		arg.Notify,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
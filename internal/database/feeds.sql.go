@@ -23,7 +23,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, title, description, site_link, language, image_url, generator, last_fetch_status, fetch_full_content, retention_max_age_days, retention_max_posts
 `
 
 type AddFeedParams struct {
@@ -53,12 +53,52 @@ func (q *Queries) AddFeed(ctx context.Context, arg AddFeedParams) (Feed, error)
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Title,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.LastFetchStatus,
+		&i.FetchFullContent,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeed = `-- name: GetFeed :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, title, description, site_link, language, image_url, generator, last_fetch_status, fetch_full_content, retention_max_age_days, retention_max_posts FROM feeds
+WHERE feeds.id = $1
+`
+
+func (q *Queries) GetFeed(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeed, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Title,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.LastFetchStatus,
+		&i.FetchFullContent,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
 
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, title, description, site_link, language, image_url, generator, last_fetch_status, fetch_full_content, retention_max_age_days, retention_max_posts FROM feeds
 WHERE feeds.url = $1
 `
 
@@ -73,6 +113,78 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Title,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.LastFetchStatus,
+		&i.FetchFullContent,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeedInfo = `-- name: GetFeedInfo :one
+SELECT
+    feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.title, feeds.description, feeds.site_link, feeds.language, feeds.image_url, feeds.generator, feeds.last_fetch_status, feeds.fetch_full_content, feeds.retention_max_age_days, feeds.retention_max_posts,
+    users.name AS added_by,
+    (SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id) AS follower_count,
+    (SELECT COUNT(*) FROM posts WHERE posts.feed_id = feeds.id) AS post_count
+FROM feeds
+INNER JOIN users ON feeds.user_id = users.id
+WHERE feeds.url = $1
+`
+
+type GetFeedInfoRow struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Title               string
+	Description         string
+	SiteLink            string
+	Language            string
+	ImageUrl            string
+	Generator           string
+	LastFetchStatus     sql.NullString
+	FetchFullContent    bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	AddedBy             string
+	FollowerCount       int64
+	PostCount           int64
+}
+
+func (q *Queries) GetFeedInfo(ctx context.Context, url string) (GetFeedInfoRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedInfo, url)
+	var i GetFeedInfoRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Title,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.LastFetchStatus,
+		&i.FetchFullContent,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+		&i.AddedBy,
+		&i.FollowerCount,
+		&i.PostCount,
 	)
 	return i, err
 }
@@ -91,7 +203,7 @@ func (q *Queries) GetFeedUser(ctx context.Context, url string) (string, error) {
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, title, description, site_link, language, image_url, generator, last_fetch_status, fetch_full_content, retention_max_age_days, retention_max_posts FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -111,6 +223,16 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Title,
+			&i.Description,
+			&i.SiteLink,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.LastFetchStatus,
+			&i.FetchFullContent,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
 		); err != nil {
 			return nil, err
 		}
@@ -126,14 +248,26 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 }
 
 const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, title, description, site_link, language, image_url, generator, last_fetch_status, fetch_full_content, retention_max_age_days, retention_max_posts
 FROM feeds
+WHERE NOT EXISTS (
+    SELECT 1 FROM websub_subscriptions
+    WHERE websub_subscriptions.feed_id = feeds.id
+        AND websub_subscriptions.state = 'active'
+        AND websub_subscriptions.lease_expires_at > $1::timestamp
+        AND feeds.last_fetched_at > $2::timestamp
+)
 ORDER BY feeds.last_fetched_at ASC NULLS FIRST
 LIMIT 1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type GetNextFeedToFetchParams struct {
+	Now       time.Time
+	PollAfter time.Time
+}
+
+func (q *Queries) GetNextFeedToFetch(ctx context.Context, arg GetNextFeedToFetchParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextFeedToFetch, arg.Now, arg.PollAfter)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -143,6 +277,16 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Title,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.LastFetchStatus,
+		&i.FetchFullContent,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
@@ -162,3 +306,102 @@ func (q *Queries) MarkFeedFetch(ctx context.Context, arg MarkFeedFetchParams) er
 	_, err := q.db.ExecContext(ctx, markFeedFetch, arg.LastFetchedAt, arg.ID)
 	return err
 }
+
+const setFeedFetchFullContent = `-- name: SetFeedFetchFullContent :exec
+UPDATE feeds
+SET fetch_full_content = $1, updated_at = $2
+WHERE url = $3
+`
+
+type SetFeedFetchFullContentParams struct {
+	FetchFullContent    bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UpdatedAt           time.Time
+	Url                 string
+}
+
+func (q *Queries) SetFeedFetchFullContent(ctx context.Context, arg SetFeedFetchFullContentParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchFullContent, arg.FetchFullContent, arg.UpdatedAt, arg.Url)
+	return err
+}
+
+const setFeedFetchStatus = `-- name: SetFeedFetchStatus :exec
+UPDATE feeds
+SET last_fetch_status = $1, updated_at = $2
+WHERE id = $3
+`
+
+type SetFeedFetchStatusParams struct {
+	LastFetchStatus sql.NullString
+	UpdatedAt       time.Time
+	ID              uuid.UUID
+}
+
+func (q *Queries) SetFeedFetchStatus(ctx context.Context, arg SetFeedFetchStatusParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchStatus, arg.LastFetchStatus, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = $1, retention_max_posts = $2, updated_at = $3
+WHERE url = $4
+`
+
+type SetFeedRetentionParams struct {
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UpdatedAt           time.Time
+	Url                 string
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRetention,
+		arg.RetentionMaxAgeDays,
+		arg.RetentionMaxPosts,
+		arg.UpdatedAt,
+		arg.Url,
+	)
+	return err
+}
+
+const updateFeedMetadata = `-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET title = $1,
+    description = $2,
+    site_link = $3,
+    language = $4,
+    image_url = $5,
+    generator = $6,
+    last_fetch_status = $7,
+    updated_at = $8
+WHERE id = $9
+`
+
+type UpdateFeedMetadataParams struct {
+	Title           string
+	Description     string
+	SiteLink        string
+	Language        string
+	ImageUrl        string
+	Generator       string
+	LastFetchStatus sql.NullString
+	UpdatedAt       time.Time
+	ID              uuid.UUID
+}
+
+func (q *Queries) UpdateFeedMetadata(ctx context.Context, arg UpdateFeedMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedMetadata,
+		arg.Title,
+		arg.Description,
+		arg.SiteLink,
+		arg.Language,
+		arg.ImageUrl,
+		arg.Generator,
+		arg.LastFetchStatus,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
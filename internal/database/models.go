@@ -11,38 +11,181 @@ import (
 	"github.com/google/uuid"
 )
 
+type DigestPost struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	SentAt time.Time
+}
+
 type Feed struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Title               string
+	Description         string
+	SiteLink            string
+	Language            string
+	ImageUrl            string
+	Generator           string
+	LastFetchStatus     sql.NullString
+	FetchFullContent    bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+}
+
+type FeedFollow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	FeedID       uuid.UUID
+	DisplayTitle sql.NullString
+	Muted        bool
+	Notify       string
+}
+
+type FeedFollowTag struct {
+	FeedFollowID uuid.UUID
+	Tag          string
+	CreatedAt    time.Time
+}
+
+type Post struct {
 	ID            uuid.UUID
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
-	Name          string
+	Title         string
 	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	Description   string
+	PublishedAt   sql.NullTime
+	FeedID        uuid.UUID
+	Content       sql.NullString
+	Author        string
+	SearchVector  interface{}
+	NormalizedUrl string
+	Simhash       int64
+	ClusterID     uuid.UUID
+	OriginalUrl   string
 }
 
-type FeedFollow struct {
+type PostCategory struct {
+	PostID   uuid.UUID
+	Category string
+}
+
+type PostEnclosure struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	PostID         uuid.UUID
+	Url            string
+	MimeType       string
+	Length         int64
+	Duration       string
+	Episode        string
+	ImageUrl       string
+	DownloadedPath sql.NullString
+	Sha256         sql.NullString
+	DownloadedAt   sql.NullTime
+}
+
+type PostMedium struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	PostID    uuid.UUID
+	Kind      string
+	Url       string
+	MimeType  string
+	Medium    string
+	Width     int32
+	Height    int32
+	Duration  int32
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type PostRuleMatch struct {
+	PostID    uuid.UUID
+	RuleID    uuid.UUID
 	UserID    uuid.UUID
-	FeedID    uuid.UUID
+	Action    string
+	CreatedAt time.Time
 }
 
-type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description string
-	PublishedAt sql.NullTime
+type PostStar struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	StarredAt time.Time
+}
+
+type PrunedPost struct {
 	FeedID      uuid.UUID
+	OriginalUrl string
+	PrunedAt    time.Time
+}
+
+type Rule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Action    string
+	Pattern   string
+	IsRegex   bool
+	Field     string
+	FeedID    uuid.NullUUID
 }
 
 type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Name            string
+	Email           sql.NullString
+	DigestFrequency string
+	LastDigestAt    sql.NullTime
+}
+
+type Webhook struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Name      string
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Url       string
+	Secret    string
+}
+
+type WebhookDelivery struct {
+	ID         uuid.UUID
+	WebhookID  uuid.UUID
+	DeliveryID uuid.UUID
+	PostID     uuid.NullUUID
+	Event      string
+	Attempt    int32
+	StatusCode sql.NullInt32
+	Error      string
+	DurationMs int32
+	CreatedAt  time.Time
+}
+
+type WebsubSubscription struct {
+	FeedID         uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	State          string
+	LeaseExpiresAt sql.NullTime
+	LastPushAt     sql.NullTime
 }
@@ -14,7 +14,7 @@ import (
 )
 
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, author, normalized_url, simhash, cluster_id, original_url)
 VALUES (
     $1, 
     $2,
@@ -23,20 +23,32 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13,
+    $14
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, content, author, search_vector, normalized_url, simhash, cluster_id, original_url
 `
 
 type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description string
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Title         string
+	Url           string
+	Description   string
+	PublishedAt   sql.NullTime
+	FeedID        uuid.UUID
+	Content       sql.NullString
+	Author        string
+	NormalizedUrl string
+	Simhash       int64
+	ClusterID     uuid.UUID
+	OriginalUrl   string
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
@@ -49,7 +61,120 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.Content,
+		arg.Author,
+		arg.NormalizedUrl,
+		arg.Simhash,
+		arg.ClusterID,
+		arg.OriginalUrl,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		&i.Author,
+		&i.SearchVector,
+		&i.NormalizedUrl,
+		&i.Simhash,
+		&i.ClusterID,
+		&i.OriginalUrl,
+	)
+	return i, err
+}
+
+const findPostCluster = `-- name: FindPostCluster :one
+SELECT cluster_id FROM posts
+WHERE id <> $1
+    AND (
+        ($2::text <> '' AND normalized_url = $2::text)
+        OR ($3::bigint <> 0 AND simhash <> 0 AND created_at > $4
+            AND bit_count((simhash # $3::bigint)::bit(64)) <= $5::int)
+    )
+ORDER BY normalized_url = $2::text DESC, created_at ASC, id ASC
+LIMIT 1
+`
+
+type FindPostClusterParams struct {
+	ID            uuid.UUID
+	NormalizedUrl string
+	Simhash       int64
+	Since         time.Time
+	MaxDistance   int32
+}
+
+func (q *Queries) FindPostCluster(ctx context.Context, arg FindPostClusterParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, findPostCluster,
+		arg.ID,
+		arg.NormalizedUrl,
+		arg.Simhash,
+		arg.Since,
+		arg.MaxDistance,
 	)
+	var cluster_id uuid.UUID
+	err := row.Scan(&cluster_id)
+	return cluster_id, err
+}
+
+const getClusterSources = `-- name: GetClusterSources :many
+SELECT
+    posts.id,
+    posts.url,
+    COALESCE(feed_follows.display_title, feeds.name)::text AS feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE posts.cluster_id = $1 AND feed_follows.user_id = $2
+ORDER BY posts.created_at ASC, posts.id ASC
+`
+
+type GetClusterSourcesParams struct {
+	ClusterID uuid.UUID
+	UserID    uuid.UUID
+}
+
+type GetClusterSourcesRow struct {
+	ID       uuid.UUID
+	Url      string
+	FeedName string
+}
+
+func (q *Queries) GetClusterSources(ctx context.Context, arg GetClusterSourcesParams) ([]GetClusterSourcesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getClusterSources, arg.ClusterID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetClusterSourcesRow
+	for rows.Next() {
+		var i GetClusterSourcesRow
+		if err := rows.Scan(&i.ID, &i.Url, &i.FeedName); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPost = `-- name: GetPost :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, author, search_vector, normalized_url, simhash, cluster_id, original_url FROM posts
+WHERE id = $1
+`
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -60,32 +185,358 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Content,
+		&i.Author,
+		&i.SearchVector,
+		&i.NormalizedUrl,
+		&i.Simhash,
+		&i.ClusterID,
+		&i.OriginalUrl,
 	)
 	return i, err
 }
 
+const getPostsWithoutNormalizedURL = `-- name: GetPostsWithoutNormalizedURL :many
+SELECT id, created_at, url FROM posts
+WHERE normalized_url = ''
+    AND (created_at, id) > ($1::timestamp, $2::uuid)
+ORDER BY created_at, id
+LIMIT $3
+`
+
+type GetPostsWithoutNormalizedURLParams struct {
+	AfterCreatedAt time.Time
+	AfterID        uuid.UUID
+	Limit          int32
+}
+
+type GetPostsWithoutNormalizedURLRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Url       string
+}
+
+func (q *Queries) GetPostsWithoutNormalizedURL(ctx context.Context, arg GetPostsWithoutNormalizedURLParams) ([]GetPostsWithoutNormalizedURLRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsWithoutNormalizedURL, arg.AfterCreatedAt, arg.AfterID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsWithoutNormalizedURLRow
+	for rows.Next() {
+		var i GetPostsWithoutNormalizedURLRow
+		if err := rows.Scan(&i.ID, &i.CreatedAt, &i.Url); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserPosts = `-- name: GetUserPosts :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id FROM posts
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.author, posts.search_vector, posts.normalized_url, posts.simhash, posts.cluster_id, posts.original_url,
+    COALESCE(feed_follows.display_title, feeds.name)::text AS feed_name,
+    EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = $1
+            AND post_rule_matches.action = 'highlight'
+    ) AS highlighted
+FROM posts
 INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+    AND (NOT $2::bool OR NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = $1
+    ))
+    AND (NOT $3::bool OR EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = $1
+    ))
+    AND ($4::text IS NULL OR feeds.url = $4::text OR feeds.name = $4::text
+        OR feed_follows.display_title = $4::text)
+    AND ($5::timestamp IS NULL OR posts.published_at >= $5::timestamp)
+    AND ($6::timestamp IS NULL OR posts.published_at < $6::timestamp)
+    AND ($7::text IS NULL OR posts.author ILIKE '%' || $7::text || '%')
+    AND ($8::text IS NULL OR EXISTS (
+        SELECT 1 FROM post_categories
+        WHERE post_categories.post_id = posts.id AND lower(post_categories.category) = lower($8::text)
+    ))
+    AND ($9::timestamp IS NULL OR (
+        CASE WHEN $10::text = 'fetched' THEN posts.created_at ELSE posts.published_at END,
+        posts.id
+    ) < ($9::timestamp, $11::uuid))
+    AND ($12::text IS NULL OR EXISTS (
+        SELECT 1 FROM feed_follow_tags
+        WHERE feed_follow_tags.feed_follow_id = feed_follows.id AND feed_follow_tags.tag = $12::text
+    ))
+    AND (NOT feed_follows.muted OR $4::text IS NOT NULL)
+    AND ($4::text IS NOT NULL OR NOT EXISTS (
+        SELECT 1 FROM posts AS earlier
+        INNER JOIN feed_follows AS earlier_follows ON earlier.feed_id = earlier_follows.feed_id
+        WHERE earlier.cluster_id = posts.cluster_id
+            AND earlier_follows.user_id = $1 AND NOT earlier_follows.muted
+            AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id)
+            AND (NOT $3::bool OR EXISTS (
+                SELECT 1 FROM post_stars
+                WHERE post_stars.post_id = earlier.id AND post_stars.user_id = $1
+            ))
+            AND ($5::timestamp IS NULL OR earlier.published_at >= $5::timestamp)
+            AND ($6::timestamp IS NULL OR earlier.published_at < $6::timestamp)
+            AND ($7::text IS NULL OR earlier.author ILIKE '%' || $7::text || '%')
+            AND ($8::text IS NULL OR EXISTS (
+                SELECT 1 FROM post_categories
+                WHERE post_categories.post_id = earlier.id AND lower(post_categories.category) = lower($8::text)
+            ))
+            AND ($12::text IS NULL OR EXISTS (
+                SELECT 1 FROM feed_follow_tags
+                WHERE feed_follow_tags.feed_follow_id = earlier_follows.id AND feed_follow_tags.tag = $12::text
+            ))
+            AND NOT EXISTS (
+                SELECT 1 FROM post_rule_matches
+                WHERE post_rule_matches.post_id = earlier.id AND post_rule_matches.user_id = $1
+                    AND post_rule_matches.action = 'mute'
+            )
+            AND (NOT $13::bool OR EXISTS (
+                SELECT 1 FROM post_rule_matches
+                WHERE post_rule_matches.post_id = earlier.id AND post_rule_matches.user_id = $1
+                    AND post_rule_matches.action = 'highlight'
+            ))
+    ))
+    AND NOT EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = $1
+            AND post_rule_matches.action = 'mute'
+    )
+    AND (NOT $13::bool OR EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = $1
+            AND post_rule_matches.action = 'highlight'
+    ))
+ORDER BY
+    CASE WHEN $10::text = 'feed' THEN COALESCE(feed_follows.display_title, feeds.name) END ASC,
+    CASE WHEN $10::text = 'feed' THEN feeds.id END ASC,
+    CASE WHEN $10::text = 'fetched' THEN posts.created_at ELSE posts.published_at END DESC,
+    posts.id DESC
+LIMIT $14
+OFFSET $15
 `
 
 type GetUserPostsParams struct {
+	UserID          uuid.UUID
+	UnreadOnly      bool
+	StarredOnly     bool
+	Feed            sql.NullString
+	Since           sql.NullTime
+	Until           sql.NullTime
+	Author          sql.NullString
+	Category        sql.NullString
+	CursorTime      sql.NullTime
+	Sort            string
+	CursorID        uuid.NullUUID
+	Tag             sql.NullString
+	HighlightedOnly bool
+	Limit           int32
+	Offset          int32
+}
+
+type GetUserPostsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Title         string
+	Url           string
+	Description   string
+	PublishedAt   sql.NullTime
+	FeedID        uuid.UUID
+	Content       sql.NullString
+	Author        string
+	SearchVector  interface{}
+	NormalizedUrl string
+	Simhash       int64
+	ClusterID     uuid.UUID
+	OriginalUrl   string
+	FeedName      string
+	Highlighted   bool
+}
+
+func (q *Queries) GetUserPosts(ctx context.Context, arg GetUserPostsParams) ([]GetUserPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserPosts,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.StarredOnly,
+		arg.Feed,
+		arg.Since,
+		arg.Until,
+		arg.Author,
+		arg.Category,
+		arg.CursorTime,
+		arg.Sort,
+		arg.CursorID,
+		arg.Tag,
+		arg.HighlightedOnly,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserPostsRow
+	for rows.Next() {
+		var i GetUserPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.Author,
+			&i.SearchVector,
+			&i.NormalizedUrl,
+			&i.Simhash,
+			&i.ClusterID,
+			&i.OriginalUrl,
+			&i.FeedName,
+			&i.Highlighted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const postExists = `-- name: PostExists :one
+SELECT EXISTS (
+    SELECT 1 FROM posts
+    WHERE feed_id = $1 AND original_url = $2
+) OR EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE feed_id = $1 AND original_url = $2
+) AS stored
+`
+
+type PostExistsParams struct {
+	FeedID      uuid.UUID
+	OriginalUrl string
+}
+
+func (q *Queries) PostExists(ctx context.Context, arg PostExistsParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, postExists, arg.FeedID, arg.OriginalUrl)
+	var stored bool
+	err := row.Scan(&stored)
+	return stored, err
+}
+
+const postVisibleToUser = `-- name: PostVisibleToUser :one
+SELECT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE user_id = $1 AND feed_id = $2 AND NOT muted
+        AND notify <> 'none'
+        AND (notify <> 'highlights' OR EXISTS (
+            SELECT 1 FROM post_rule_matches
+            WHERE post_id = $3 AND user_id = $1 AND action = 'highlight'
+        ))
+) AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_id = $3 AND user_id = $1 AND action = 'mute'
+) AS visible
+`
+
+type PostVisibleToUserParams struct {
 	UserID uuid.UUID
-	Limit  int32
+	FeedID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) PostVisibleToUser(ctx context.Context, arg PostVisibleToUserParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, postVisibleToUser, arg.UserID, arg.FeedID, arg.PostID)
+	var visible bool
+	err := row.Scan(&visible)
+	return visible, err
+}
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.author, posts.search_vector, posts.normalized_url, posts.simhash, posts.cluster_id, posts.original_url,
+    feeds.name AS feed_name,
+    ts_rank(posts.search_vector, websearch_to_tsquery('english', $1::text)) AS rank
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.search_vector @@ websearch_to_tsquery('english', $1::text)
+    AND ($2::bool OR EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $3
+            AND NOT feed_follows.muted
+    ))
+    AND NOT EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = $3
+            AND post_rule_matches.action = 'mute'
+    )
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $4
+`
+
+type SearchPostsParams struct {
+	Query    string
+	AllFeeds bool
+	UserID   uuid.UUID
+	Limit    int32
 }
 
-func (q *Queries) GetUserPosts(ctx context.Context, arg GetUserPostsParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getUserPosts, arg.UserID, arg.Limit)
+type SearchPostsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Title         string
+	Url           string
+	Description   string
+	PublishedAt   sql.NullTime
+	FeedID        uuid.UUID
+	Content       sql.NullString
+	Author        string
+	SearchVector  interface{}
+	NormalizedUrl string
+	Simhash       int64
+	ClusterID     uuid.UUID
+	OriginalUrl   string
+	FeedName      string
+	Rank          float32
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.Query,
+		arg.AllFeeds,
+		arg.UserID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []SearchPostsRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -95,6 +546,15 @@ func (q *Queries) GetUserPosts(ctx context.Context, arg GetUserPostsParams) ([]P
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Content,
+			&i.Author,
+			&i.SearchVector,
+			&i.NormalizedUrl,
+			&i.Simhash,
+			&i.ClusterID,
+			&i.OriginalUrl,
+			&i.FeedName,
+			&i.Rank,
 		); err != nil {
 			return nil, err
 		}
@@ -108,3 +568,62 @@ func (q *Queries) GetUserPosts(ctx context.Context, arg GetUserPostsParams) ([]P
 	}
 	return items, nil
 }
+
+const setPostCluster = `-- name: SetPostCluster :exec
+UPDATE posts
+SET cluster_id = $1, updated_at = $2
+WHERE id = $3
+`
+
+type SetPostClusterParams struct {
+	ClusterID uuid.UUID
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) SetPostCluster(ctx context.Context, arg SetPostClusterParams) error {
+	_, err := q.db.ExecContext(ctx, setPostCluster, arg.ClusterID, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setPostNormalizedURL = `-- name: SetPostNormalizedURL :exec
+UPDATE posts
+SET normalized_url = $1,
+    cluster_id = COALESCE((
+        SELECT earlier.cluster_id FROM posts AS earlier
+        WHERE earlier.normalized_url = $1
+            AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id)
+        ORDER BY earlier.created_at, earlier.id
+        LIMIT 1
+    ), cluster_id),
+    updated_at = $2
+WHERE id = $3
+`
+
+type SetPostNormalizedURLParams struct {
+	NormalizedUrl string
+	UpdatedAt     time.Time
+	ID            uuid.UUID
+}
+
+func (q *Queries) SetPostNormalizedURL(ctx context.Context, arg SetPostNormalizedURLParams) error {
+	_, err := q.db.ExecContext(ctx, setPostNormalizedURL, arg.NormalizedUrl, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const updatePostContent = `-- name: UpdatePostContent :exec
+UPDATE posts
+SET content = $1, updated_at = $2
+WHERE id = $3
+`
+
+type UpdatePostContentParams struct {
+	Content   sql.NullString
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdatePostContent(ctx context.Context, arg UpdatePostContentParams) error {
+	_, err := q.db.ExecContext(ctx, updatePostContent, arg.Content, arg.UpdatedAt, arg.ID)
+	return err
+}
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -29,7 +30,7 @@ VALUES (
     $3,
     $4
 )
-RETURNING id, created_at, updated_at, name
+RETURNING id, created_at, updated_at, name, email, digest_frequency, last_digest_at
 `
 
 type CreateUserParams struct {
@@ -52,12 +53,52 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.Email,
+		&i.DigestFrequency,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
 
+const getDigestSubscribers = `-- name: GetDigestSubscribers :many
+SELECT id, created_at, updated_at, name, email, digest_frequency, last_digest_at FROM users
+WHERE digest_frequency <> 'off' AND email IS NOT NULL
+ORDER BY name ASC
+`
+
+func (q *Queries) GetDigestSubscribers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestSubscribers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Email,
+			&i.DigestFrequency,
+			&i.LastDigestAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, name FROM users
+SELECT id, created_at, updated_at, name, email, digest_frequency, last_digest_at FROM users
 WHERE name=$1 LIMIT 1
 `
 
@@ -69,12 +110,15 @@ func (q *Queries) GetUser(ctx context.Context, name string) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.Email,
+		&i.DigestFrequency,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
 
 const getUsers = `-- name: GetUsers :many
-SELECT id, created_at, updated_at, name FROM users
+SELECT id, created_at, updated_at, name, email, digest_frequency, last_digest_at FROM users
 `
 
 func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
@@ -91,6 +135,9 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Name,
+			&i.Email,
+			&i.DigestFrequency,
+			&i.LastDigestAt,
 		); err != nil {
 			return nil, err
 		}
@@ -104,3 +151,42 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 	}
 	return items, nil
 }
+
+const setUserDigest = `-- name: SetUserDigest :exec
+UPDATE users
+SET email = $1, digest_frequency = $2, updated_at = $3
+WHERE id = $4
+`
+
+type SetUserDigestParams struct {
+	Email           sql.NullString
+	DigestFrequency string
+	UpdatedAt       time.Time
+	ID              uuid.UUID
+}
+
+func (q *Queries) SetUserDigest(ctx context.Context, arg SetUserDigestParams) error {
+	_, err := q.db.ExecContext(ctx, setUserDigest,
+		arg.Email,
+		arg.DigestFrequency,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const setUserLastDigest = `-- name: SetUserLastDigest :exec
+UPDATE users
+SET last_digest_at = $1
+WHERE id = $2
+`
+
+type SetUserLastDigestParams struct {
+	LastDigestAt sql.NullTime
+	ID           uuid.UUID
+}
+
+func (q *Queries) SetUserLastDigest(ctx context.Context, arg SetUserLastDigestParams) error {
+	_, err := q.db.ExecContext(ctx, setUserLastDigest, arg.LastDigestAt, arg.ID)
+	return err
+}
@@ -12,7 +12,12 @@ import (
 
 type state struct {
 	cfg *config.Config
+	db  *sql.DB
 	dbq *database.Queries
+	// Set while aggregating, hooks and websub only when configured
+	webhooks *webhookDispatcher
+	hooks    *hookRunner
+	websub   *websubSubscriber
 }
 
 func main() {
@@ -25,6 +30,7 @@ func main() {
 
 	programState := state{
 		cfg: &cfg,
+		db:  db,
 		dbq: database.New(db),
 	}
 	cmds := commands{
@@ -37,10 +43,33 @@ func main() {
 	cmds.register("agg", handlerAggregator)
 	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	cmds.register("feeds", handlerGetFeeds)
+	cmds.register("feedinfo", handlerFeedInfo)
+	cmds.register("fullcontent", handlerFullContent)
+	cmds.register("retention", handlerRetention)
 	cmds.register("follow", middlewareLoggedIn(handlerFollow))
 	cmds.register("following", handlerFollowing)
 	cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
+	cmds.register("rename", middlewareLoggedIn(handlerRename))
+	cmds.register("mute", middlewareLoggedIn(handlerMute))
+	cmds.register("unmute", middlewareLoggedIn(handlerMute))
+	cmds.register("notify", middlewareLoggedIn(handlerNotify))
+	cmds.register("tag", middlewareLoggedIn(handlerTag))
+	cmds.register("untag", middlewareLoggedIn(handlerUntag))
+	cmds.register("rule", middlewareLoggedIn(handlerRule))
+	cmds.register("webhook", middlewareLoggedIn(handlerWebhook))
 	cmds.register("browse", middlewareLoggedIn(handlerBrowse))
+	cmds.register("search", middlewareLoggedIn(handlerSearch))
+	cmds.register("read", middlewareLoggedIn(handlerRead))
+	cmds.register("unread", middlewareLoggedIn(handlerUnread))
+	cmds.register("markread", middlewareLoggedIn(handlerMarkRead))
+	cmds.register("star", middlewareLoggedIn(handlerStar))
+	cmds.register("unstar", middlewareLoggedIn(handlerUnstar))
+	cmds.register("import", middlewareLoggedIn(handlerImport))
+	cmds.register("export", middlewareLoggedIn(handlerExport))
+	cmds.register("publish", middlewareLoggedIn(handlerPublish))
+	cmds.register("digest", middlewareLoggedIn(handlerDigest))
+	cmds.register("download", handlerDownload)
+	cmds.register("prune", handlerPrune)
 	args := os.Args
 	if len(args) < 2 {
 		fmt.Println("Require an argument, received", len(args)-1)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+// Media RSS (http://search.yahoo.com/mrss/) elements, as used by YouTube,
+// Flickr and many news sites.
+type RSSMediaGroup struct {
+	Contents    []RSSMediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails  []RSSMediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Description string              `xml:"http://search.yahoo.com/mrss/ description"`
+}
+
+type RSSMediaContent struct {
+	Url        string              `xml:"url,attr"`
+	Type       string              `xml:"type,attr"`
+	Medium     string              `xml:"medium,attr"`
+	Width      string              `xml:"width,attr"`
+	Height     string              `xml:"height,attr"`
+	Duration   string              `xml:"duration,attr"`
+	Thumbnails []RSSMediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type RSSMediaThumbnail struct {
+	Url    string `xml:"url,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+}
+
+const (
+	mediaKindContent   = "content"
+	mediaKindThumbnail = "thumbnail"
+)
+
+// addPostMedia stores every media:content and media:thumbnail found on the
+// item, whether at the item level, inside a media:group, or nested in a
+// media:content element.
+func addPostMedia(post RSSItem, postID uuid.UUID, ctx context.Context, q *database.Queries) error {
+	for _, param := range postMediaParams(post) {
+		param.ID = uuid.New()
+		param.CreatedAt = time.Now()
+		param.UpdatedAt = time.Now()
+		param.PostID = postID
+		err := q.CreatePostMedia(ctx, param)
+		if err != nil {
+			return fmt.Errorf("unable to add media to database: %w", err)
+		}
+	}
+	return nil
+}
+
+// postMediaParams collects the item's media with a url, leaving the ids and
+// timestamps for the caller to fill in.
+func postMediaParams(post RSSItem) []database.CreatePostMediaParams {
+	contents := post.MediaContents
+	thumbnails := post.MediaThumbnails
+	for _, group := range post.MediaGroups {
+		contents = append(contents, group.Contents...)
+		thumbnails = append(thumbnails, group.Thumbnails...)
+	}
+	for _, content := range contents {
+		thumbnails = append(thumbnails, content.Thumbnails...)
+	}
+
+	params := []database.CreatePostMediaParams{}
+	for _, content := range contents {
+		params = append(params, database.CreatePostMediaParams{
+			Kind:     mediaKindContent,
+			Url:      content.Url,
+			MimeType: content.Type,
+			Medium:   content.Medium,
+			Width:    parseMediaInt(content.Width),
+			Height:   parseMediaInt(content.Height),
+			Duration: parseMediaInt(content.Duration),
+		})
+	}
+	for _, thumbnail := range thumbnails {
+		params = append(params, database.CreatePostMediaParams{
+			Kind:   mediaKindThumbnail,
+			Url:    thumbnail.Url,
+			Medium: "image",
+			Width:  parseMediaInt(thumbnail.Width),
+			Height: parseMediaInt(thumbnail.Height),
+		})
+	}
+
+	return slices.DeleteFunc(params, func(param database.CreatePostMediaParams) bool {
+		return param.Url == ""
+	})
+}
+
+// parseMediaInt reads optional numeric attributes, treating missing or
+// malformed values (including fractional durations) as 0.
+func parseMediaInt(value string) int32 {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, "."); i >= 0 {
+		value = value[:i]
+	}
+	i, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(i)
+}
+
+// postThumbnail returns the largest thumbnail stored for a post, if any.
+func postThumbnail(media []database.PostMedium) (database.PostMedium, bool) {
+	best := database.PostMedium{}
+	found := false
+	for _, medium := range media {
+		if medium.Kind != mediaKindThumbnail {
+			continue
+		}
+		if !found || medium.Width > best.Width {
+			best = medium
+			found = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+		OwnerName   string `xml:"ownerName,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// OPMLOutline is either a feed, when XMLUrl is set, or a folder of further
+// outlines.
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLUrl   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLUrl  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// opmlFeed is a feed found in an OPML file, with the folders it was in.
+type opmlFeed struct {
+	name string
+	url  string
+	tags []string
+}
+
+func handlerImport(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("missing import type: import opml <file>")
+	}
+	subcommand := command{name: cmd.name + " " + cmd.args[0], args: cmd.args[1:]}
+	switch cmd.args[0] {
+	case "opml":
+		return importOPML(s, subcommand, loggedInUser)
+	default:
+		return fmt.Errorf("unknown import type '%s': expected opml", cmd.args[0])
+	}
+}
+
+func importOPML(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: import opml <file>")
+	}
+	data, err := os.ReadFile(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("unable to read OPML file: %w", err)
+	}
+	var opml OPML
+	err = xml.Unmarshal(data, &opml)
+	if err != nil {
+		return fmt.Errorf("unable to parse OPML file: %w", err)
+	}
+	feeds := dedupeOPMLFeeds(collectOPMLFeeds(opml.Body.Outlines, nil))
+	if len(feeds) == 0 {
+		return fmt.Errorf("no feeds found in %s", cmd.args[0])
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.dbq.WithTx(tx)
+
+	created, existing, failed := 0, 0, 0
+	for _, feed := range feeds {
+		// A savepoint per feed lets one bad feed fail without aborting the
+		// rest of the import
+		_, err = tx.ExecContext(ctx, "SAVEPOINT import_feed")
+		if err != nil {
+			return fmt.Errorf("unable to create savepoint: %w", err)
+		}
+		isNew, err := importFeed(ctx, qtx, feed, loggedInUser)
+		if err != nil {
+			fmt.Printf("Unable to import %s <%s>: %s\n", feed.name, feed.url, err)
+			failed++
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_feed")
+			if err != nil {
+				return fmt.Errorf("unable to roll back to savepoint: %w", err)
+			}
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_feed")
+			if err != nil {
+				return fmt.Errorf("unable to release savepoint: %w", err)
+			}
+			continue
+		}
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_feed")
+		if err != nil {
+			return fmt.Errorf("unable to release savepoint: %w", err)
+		}
+		if isNew {
+			created++
+		} else {
+			existing++
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unable to commit import: %w", err)
+	}
+	fmt.Printf("Imported %d feeds: %d created, %d existing, %d failed\n", len(feeds), created, existing, failed)
+	return nil
+}
+
+// collectOPMLFeeds flattens nested outlines into feeds, tagging each feed
+// with the titles of the folders it is nested in.
+func collectOPMLFeeds(outlines []OPMLOutline, folders []string) []opmlFeed {
+	feeds := []opmlFeed{}
+	for _, outline := range outlines {
+		title := strings.TrimSpace(outline.Text)
+		if title == "" {
+			title = strings.TrimSpace(outline.Title)
+		}
+		if feedUrl := strings.TrimSpace(outline.XMLUrl); feedUrl != "" {
+			if title == "" {
+				title = feedUrl
+			}
+			feeds = append(feeds, opmlFeed{
+				name: title,
+				url:  feedUrl,
+				tags: folders,
+			})
+			continue
+		}
+		nested := folders
+		if title != "" {
+			nested = append(append([]string{}, folders...), title)
+		}
+		feeds = append(feeds, collectOPMLFeeds(outline.Outlines, nested)...)
+	}
+	return feeds
+}
+
+// dedupeOPMLFeeds merges feeds listed more than once, such as a feed filed
+// under several folders, keeping the first name and every folder.
+func dedupeOPMLFeeds(feeds []opmlFeed) []opmlFeed {
+	unique := []opmlFeed{}
+	seen := map[string]int{}
+	for _, feed := range feeds {
+		index, found := seen[feed.url]
+		if !found {
+			seen[feed.url] = len(unique)
+			unique = append(unique, feed)
+			continue
+		}
+		for _, tag := range feed.tags {
+			if !slices.Contains(unique[index].tags, tag) {
+				unique[index].tags = append(slices.Clone(unique[index].tags), tag)
+			}
+		}
+	}
+	return unique
+}
+
+// importFeed adds the feed if it isn't registered yet, follows it and tags
+// the follow with the feed's folders. It reports whether the feed was new.
+func importFeed(ctx context.Context, q *database.Queries, feed opmlFeed, loggedInUser database.User) (bool, error) {
+	isNew := false
+	entry, err := q.GetFeedByURL(ctx, feed.url)
+	if errors.Is(err, sql.ErrNoRows) {
+		entry, err = q.AddFeed(ctx, database.AddFeedParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Name:      feed.name,
+			Url:       feed.url,
+			UserID:    loggedInUser.ID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to add feed: %w", err)
+		}
+		isNew = true
+	} else if err != nil {
+		return false, fmt.Errorf("unable to look up feed: %w", err)
+	}
+
+	followID := uuid.UUID{}
+	follow, err := q.GetFeedFollow(ctx, database.GetFeedFollowParams{
+		UserID: loggedInUser.ID,
+		Url:    entry.Url,
+	})
+	switch {
+	case err == nil:
+		followID = follow.ID
+	case errors.Is(err, sql.ErrNoRows):
+		created, err := q.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    loggedInUser.ID,
+			FeedID:    entry.ID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to follow feed: %w", err)
+		}
+		followID = created.ID
+	default:
+		return false, fmt.Errorf("unable to look up feed follow: %w", err)
+	}
+
+	for _, tag := range feed.tags {
+		err = q.AddFeedFollowTag(ctx, database.AddFeedFollowTagParams{
+			FeedFollowID: followID,
+			Tag:          tag,
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to tag feed: %w", err)
+		}
+	}
+	return isNew, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+// Unread posts fetched within this long are kept when no
+// retention_keep_unread is configured.
+const defaultKeepUnread = 30 * 24 * time.Hour
+
+// retentionPolicy is the global policy applied to feeds without their own
+// limits. Zero values mean no limit.
+type retentionPolicy struct {
+	maxAge     time.Duration
+	maxPosts   int
+	keepUnread time.Duration
+}
+
+func configRetentionPolicy(s *state) (retentionPolicy, error) {
+	policy := retentionPolicy{
+		maxPosts:   s.cfg.RetentionMaxPosts,
+		keepUnread: defaultKeepUnread,
+	}
+	var err error
+	if s.cfg.RetentionMaxAge != "" {
+		policy.maxAge, err = parseDurationArg(s.cfg.RetentionMaxAge)
+		if err != nil {
+			return policy, fmt.Errorf("unable to parse retention_max_age: %w", err)
+		}
+	}
+	if s.cfg.RetentionKeepUnread != "" {
+		policy.keepUnread, err = parseDurationArg(s.cfg.RetentionKeepUnread)
+		if err != nil {
+			return policy, fmt.Errorf("unable to parse retention_keep_unread: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+func handlerPrune(s *state, cmd command) error {
+	policy, err := configRetentionPolicy(s)
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the posts that would be deleted without deleting them")
+	maxAge := flags.String("max-age", "", "delete posts fetched longer ago than this, e.g. 90d")
+	maxPosts := flags.Int("max-posts", policy.maxPosts, "keep at most this many posts per feed")
+	keepUnread := flags.String("keep-unread", "", "always keep unread posts fetched within this long, e.g. 14d")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("too many arguments: prune [--dry-run] [--max-age <duration>] [--max-posts <n>] [--keep-unread <duration>]")
+	}
+	if *maxAge != "" {
+		policy.maxAge, err = parseDurationArg(*maxAge)
+		if err != nil {
+			return fmt.Errorf("unable to parse max age: %w", err)
+		}
+	}
+	if *keepUnread != "" {
+		policy.keepUnread, err = parseDurationArg(*keepUnread)
+		if err != nil {
+			return fmt.Errorf("unable to parse keep unread duration: %w", err)
+		}
+	}
+	policy.maxPosts = *maxPosts
+
+	posts, err := prunePosts(context.Background(), s, policy, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, post := range posts {
+			fmt.Printf("%s: \"%s\" <%s> (fetched %s)\n", post.FeedName, post.Title, post.Url, post.CreatedAt.Format(time.DateOnly))
+		}
+		fmt.Printf("Would delete %d posts\n", len(posts))
+		return nil
+	}
+	fmt.Printf("Deleted %d posts\n", len(posts))
+	return nil
+}
+
+// prunePosts deletes the posts that fall outside the retention policy or
+// their feed's own limits, returning them. Starred posts, and unread posts
+// fetched within policy.keepUnread, are always kept.
+func prunePosts(ctx context.Context, s *state, policy retentionPolicy, dryRun bool) ([]database.GetPrunablePostsRow, error) {
+	now := time.Now()
+	params := database.GetPrunablePostsParams{
+		Now:             now,
+		KeepUnreadSince: now.Add(-policy.keepUnread),
+	}
+	if policy.maxAge > 0 {
+		params.MaxAgeCutoff = sql.NullTime{Time: now.Add(-policy.maxAge), Valid: true}
+	}
+	if policy.maxPosts > 0 {
+		params.MaxPosts = sql.NullInt32{Int32: int32(policy.maxPosts), Valid: true}
+	}
+	posts, err := s.dbq.GetPrunablePosts(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find posts to prune: %w", err)
+	}
+	if dryRun || len(posts) == 0 {
+		return posts, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	err = s.dbq.PrunePosts(ctx, database.PrunePostsParams{
+		Ids:      ids,
+		PrunedAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete posts: %w", err)
+	}
+	return posts, nil
+}
+
+func handlerRetention(s *state, cmd command) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	maxAge := flags.String("max-age", "", "delete this feed's posts fetched longer ago than this many days, e.g. 30d, or off")
+	maxPosts := flags.String("max-posts", "", "keep at most this many of this feed's posts, or off")
+	reset := flags.Bool("reset", false, "go back to the global retention policy")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: retention <feed_url> [--max-age <days>d|off] [--max-posts <n>|off] [--reset]")
+	}
+	feed, err := s.dbq.GetFeedByURL(context.Background(), args[0])
+	if err != nil {
+		return fmt.Errorf("feed url not found: %w", err)
+	}
+	if *maxAge == "" && *maxPosts == "" && !*reset {
+		fmt.Printf("Retention for '%s': max age %s, max posts %s\n", feed.Name,
+			describeRetention(feed.RetentionMaxAgeDays, "d"), describeRetention(feed.RetentionMaxPosts, ""))
+		return nil
+	}
+
+	params := database.SetFeedRetentionParams{
+		RetentionMaxAgeDays: feed.RetentionMaxAgeDays,
+		RetentionMaxPosts:   feed.RetentionMaxPosts,
+		UpdatedAt:           time.Now(),
+		Url:                 feed.Url,
+	}
+	if *reset {
+		params.RetentionMaxAgeDays = sql.NullInt32{}
+		params.RetentionMaxPosts = sql.NullInt32{}
+	}
+	if *maxAge != "" {
+		days := 0
+		if *maxAge != "off" {
+			age, err := parseDurationArg(*maxAge)
+			if err != nil {
+				return fmt.Errorf("unable to parse max age: %w", err)
+			}
+			if age <= 0 || age%(24*time.Hour) != 0 {
+				return fmt.Errorf("max age must be a whole number of days, e.g. 30d")
+			}
+			days = int(age / (24 * time.Hour))
+		}
+		params.RetentionMaxAgeDays = sql.NullInt32{Int32: int32(days), Valid: true}
+	}
+	if *maxPosts != "" {
+		n := 0
+		if *maxPosts != "off" {
+			n, err = strconv.Atoi(*maxPosts)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("argument %s not recognised: expected a positive number or off", *maxPosts)
+			}
+		}
+		params.RetentionMaxPosts = sql.NullInt32{Int32: int32(n), Valid: true}
+	}
+	err = s.dbq.SetFeedRetention(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("unable to update feed: %w", err)
+	}
+	fmt.Printf("Retention for '%s' set to max age %s, max posts %s\n", feed.Name,
+		describeRetention(params.RetentionMaxAgeDays, "d"), describeRetention(params.RetentionMaxPosts, ""))
+	return nil
+}
+
+func describeRetention(limit sql.NullInt32, unit string) string {
+	switch {
+	case !limit.Valid:
+		return "default"
+	case limit.Int32 == 0:
+		return "off"
+	default:
+		return fmt.Sprintf("%d%s", limit.Int32, unit)
+	}
+}
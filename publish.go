@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+// Slugs in file names are kept well under the usual 255 byte limit on file
+// names, leaving room for a date or id.
+const maxSlugBytes = 80
+
+//go:embed templates/publish.html
+var publishTemplates embed.FS
+
+var publishTemplate = template.Must(template.ParseFS(publishTemplates, "templates/publish.html"))
+
+// publishedPost is a post as shown on the generated site.
+type publishedPost struct {
+	Title     string
+	Url       string
+	Feed      string
+	FeedPath  string
+	DayPath   string
+	Author    string
+	Published time.Time
+	Body      template.HTML
+}
+
+// publishIndex is a listing of posts: the whole timeline, one day, one feed
+// or one tag.
+type publishIndex struct {
+	Name  string
+	Path  string
+	Count int
+	posts []publishedPost
+}
+
+type publishPage struct {
+	SiteTitle string
+	Heading   string
+	Root      string
+	Posts     []publishedPost
+	Page      int
+	Pages     int
+	Prev      string
+	Next      string
+	Days      []*publishIndex
+	Feeds     []*publishIndex
+	Tags      []*publishIndex
+	Generated time.Time
+}
+
+func handlerPublish(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	limit := flags.Int("limit", 500, "maximum number of posts to publish")
+	perPage := flags.Int("per-page", 25, "posts per page")
+	title := flags.String("title", fmt.Sprintf("%s's gator", loggedInUser.Name), "site title")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: publish [--limit <n>] [--per-page <n>] [--title <title>] <dir>")
+	}
+	if *limit <= 0 || *perPage <= 0 {
+		return fmt.Errorf("limit and per-page must be positive")
+	}
+	dir := args[0]
+
+	posts, err := s.dbq.GetUserPosts(context.Background(), database.GetUserPostsParams{
+		UserID: loggedInUser.ID,
+		Sort:   "published",
+		Limit:  int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve user's posts: %w", err)
+	}
+	follows, err := s.dbq.GetFollowingWithTags(context.Background(), loggedInUser.Name)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve followed feeds: %w", err)
+	}
+	feedTags := map[uuid.UUID][]string{}
+	for _, follow := range follows {
+		if follow.Tag.Valid {
+			feedTags[follow.FeedID] = append(feedTags[follow.FeedID], follow.Tag.String)
+		}
+	}
+
+	all := &publishIndex{Name: "Latest posts", Path: "index.html"}
+	days := map[string]*publishIndex{}
+	feeds := map[uuid.UUID]*publishIndex{}
+	tags := map[string]*publishIndex{}
+	for _, post := range posts {
+		published := postTime(post)
+		day := published.Format(time.DateOnly)
+		if days[day] == nil {
+			days[day] = &publishIndex{Name: day, Path: "day/" + day + ".html"}
+		}
+		if feeds[post.FeedID] == nil {
+			feeds[post.FeedID] = &publishIndex{
+				Name: post.FeedName,
+				Path: "feed/" + fileSlug(post.FeedName) + "-" + post.FeedID.String()[:8] + ".html",
+			}
+		}
+		item := publishedPost{
+			Title:     post.Title,
+			Url:       post.Url,
+			Feed:      post.FeedName,
+			FeedPath:  feeds[post.FeedID].Path,
+			DayPath:   days[day].Path,
+			Author:    post.Author,
+			Published: published,
+			Body:      template.HTML(sanitizeHTML(postBody(post.Description, post.Content))),
+		}
+		indexes := []*publishIndex{all, days[day], feeds[post.FeedID]}
+		for _, tag := range feedTags[post.FeedID] {
+			if tags[tag] == nil {
+				tags[tag] = &publishIndex{Name: tag, Path: "tag/" + fileSlug(tag) + "-" + shortHash(tag) + ".html"}
+			}
+			indexes = append(indexes, tags[tag])
+		}
+		for _, index := range indexes {
+			index.posts = append(index.posts, item)
+			index.Count++
+		}
+	}
+
+	page := publishPage{
+		SiteTitle: *title,
+		Days:      sortedIndexes(days, func(a, b *publishIndex) bool { return a.Name > b.Name }),
+		Feeds:     sortedIndexes(feeds, func(a, b *publishIndex) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }),
+		Tags:      sortedIndexes(tags, func(a, b *publishIndex) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }),
+		Generated: time.Now(),
+	}
+	indexes := []*publishIndex{all}
+	indexes = append(indexes, page.Days...)
+	indexes = append(indexes, page.Feeds...)
+	indexes = append(indexes, page.Tags...)
+	for _, subdir := range []string{"day", "feed", "tag"} {
+		err = os.MkdirAll(filepath.Join(dir, subdir), 0o755)
+		if err != nil {
+			return fmt.Errorf("unable to create output directory: %w", err)
+		}
+	}
+	files := 0
+	for _, index := range indexes {
+		written, err := writeIndexPages(dir, index, page, *perPage)
+		if err != nil {
+			return err
+		}
+		files += written
+	}
+	fmt.Printf("Published %d posts to %s (%d pages)\n", len(posts), dir, files)
+	return nil
+}
+
+// writeIndexPages writes an index as numbered pages: "feed/go.html",
+// "feed/go-2.html" and so on. It returns the number of files written.
+func writeIndexPages(dir string, index *publishIndex, page publishPage, perPage int) (int, error) {
+	pages := max(1, (len(index.posts)+perPage-1)/perPage)
+	base := strings.TrimSuffix(index.Path, ".html")
+	pagePath := func(n int) string {
+		if n == 1 {
+			return base + ".html"
+		}
+		return fmt.Sprintf("%s-%d.html", base, n)
+	}
+
+	page.Heading = index.Name
+	page.Pages = pages
+	if strings.Contains(index.Path, "/") {
+		page.Root = "../"
+	}
+	for n := 1; n <= pages; n++ {
+		page.Page = n
+		page.Posts = index.posts[(n-1)*perPage : min(n*perPage, len(index.posts))]
+		page.Prev, page.Next = "", ""
+		// Prev and next links are relative to the page's own directory
+		if n > 1 {
+			page.Prev = filepath.Base(pagePath(n - 1))
+		}
+		if n < pages {
+			page.Next = filepath.Base(pagePath(n + 1))
+		}
+		err := writePublishPage(filepath.Join(dir, filepath.FromSlash(pagePath(n))), page)
+		if err != nil {
+			return n - 1, err
+		}
+	}
+	return pages, nil
+}
+
+func writePublishPage(path string, page publishPage) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create page: %w", err)
+	}
+	defer f.Close()
+	err = publishTemplate.Execute(f, page)
+	if err != nil {
+		return fmt.Errorf("unable to render %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func sortedIndexes[K comparable](indexes map[K]*publishIndex, less func(a, b *publishIndex) bool) []*publishIndex {
+	sorted := make([]*publishIndex, 0, len(indexes))
+	for _, index := range indexes {
+		sorted = append(sorted, index)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// shortHash tells apart names that slugify the same, such as "Go" and "go!".
+func shortHash(name string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// slugify turns a name into a string that is safe to use as a file name.
+func slugify(name string) string {
+	var out strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out.WriteRune(r)
+			dash = false
+		} else if !dash && out.Len() > 0 {
+			out.WriteRune('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(out.String(), "-")
+	if slug == "" {
+		return "untitled"
+	}
+	return slug
+}
+
+// fileSlug is slugify cut to at most maxSlugBytes, at a rune boundary.
+func fileSlug(name string) string {
+	slug := slugify(name)
+	if len(slug) <= maxSlugBytes {
+		return slug
+	}
+	cut := maxSlugBytes
+	for cut > 0 && !utf8.RuneStart(slug[cut]) {
+		cut--
+	}
+	return strings.TrimSuffix(slug[:cut], "-")
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/term"
+)
+
+// Elements whose contents are never shown to the reader.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Head:     true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Svg:      true,
+	atom.Math:     true,
+}
+
+// Elements that start a new paragraph when rendered as text.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Main: true, atom.Aside: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+	atom.Table: true, atom.Tr: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Hr: true,
+}
+
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+	if width < 20 {
+		return 20
+	}
+	return width
+}
+
+// parseHTMLFragment parses a post body, which is usually a fragment rather
+// than a full document.
+func parseHTMLFragment(body string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(body), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+type textBlock struct {
+	prefix   string
+	indent   int
+	text     string
+	pre      bool
+	listItem bool
+}
+
+type textRenderer struct {
+	blocks    []textBlock
+	current   strings.Builder
+	footnotes []string
+	lists     []int // item counter per open list, -1 for unordered lists
+	quotes    int
+	pre       int
+	bullet    string
+}
+
+// renderText converts an HTML post body into plain text for the terminal:
+// paragraphs are wrapped to width, list items get bullets, links become
+// numbered footnotes and scripts/styles are stripped.
+func renderText(body string, width int) string {
+	nodes, err := parseHTMLFragment(body)
+	if err != nil {
+		return body
+	}
+	r := &textRenderer{}
+	for _, n := range nodes {
+		r.walk(n)
+	}
+	r.flush()
+
+	var out strings.Builder
+	for i, block := range r.blocks {
+		if i > 0 {
+			if block.listItem && r.blocks[i-1].listItem {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		out.WriteString(block.render(width))
+	}
+	if len(r.footnotes) > 0 {
+		out.WriteString("\n")
+		for i, link := range r.footnotes {
+			fmt.Fprintf(&out, "\n[%d] %s", i+1, link)
+		}
+	}
+	return out.String()
+}
+
+func (r *textRenderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.writeText(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			r.walk(c)
+		}
+		return
+	}
+	if droppedElements[n.DataAtom] {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		r.flush()
+		return
+	case atom.Hr:
+		r.flush()
+		r.blocks = append(r.blocks, textBlock{text: "----", pre: true})
+		return
+	case atom.Img:
+		alt := strings.TrimSpace(getAttr(n, "alt"))
+		if alt == "" {
+			alt = "image"
+		}
+		r.writeText(" [" + alt + "]")
+		r.addFootnote(getAttr(n, "src"))
+		return
+	}
+
+	block := blockElements[n.DataAtom]
+	if block {
+		r.flush()
+	}
+	switch n.DataAtom {
+	case atom.Ul:
+		r.lists = append(r.lists, -1)
+	case atom.Ol:
+		r.lists = append(r.lists, 0)
+	case atom.Li:
+		if len(r.lists) > 0 && r.lists[len(r.lists)-1] >= 0 {
+			r.lists[len(r.lists)-1]++
+			r.bullet = fmt.Sprintf("%d. ", r.lists[len(r.lists)-1])
+		} else {
+			r.bullet = "• "
+		}
+	case atom.Blockquote:
+		r.quotes++
+	case atom.Pre:
+		r.pre++
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+
+	switch n.DataAtom {
+	case atom.A:
+		r.addFootnote(getAttr(n, "href"))
+	case atom.Ul, atom.Ol:
+		r.flush()
+		r.lists = r.lists[:len(r.lists)-1]
+	case atom.Blockquote:
+		r.flush()
+		r.quotes--
+	case atom.Pre:
+		r.flush()
+		r.pre--
+	}
+	if block {
+		r.flush()
+	}
+}
+
+func (r *textRenderer) writeText(text string) {
+	if r.pre > 0 {
+		r.current.WriteString(text)
+		return
+	}
+	// Collapse whitespace runs, keeping a single space at either edge so
+	// words either side of inline elements stay separated
+	if text != "" && isSpace(text[0]) {
+		r.current.WriteString(" ")
+	}
+	collapsed := strings.Join(strings.Fields(text), " ")
+	r.current.WriteString(collapsed)
+	if collapsed != "" && isSpace(text[len(text)-1]) {
+		r.current.WriteString(" ")
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+func (r *textRenderer) addFootnote(link string) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(strings.ToLower(link), "javascript:") {
+		return
+	}
+	r.footnotes = append(r.footnotes, link)
+	fmt.Fprintf(&r.current, "[%d]", len(r.footnotes))
+}
+
+func (r *textRenderer) flush() {
+	text := r.current.String()
+	r.current.Reset()
+	if r.pre == 0 {
+		text = strings.TrimSpace(text)
+	} else {
+		text = strings.Trim(text, "\n")
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	indent := 0
+	if len(r.lists) > 0 {
+		indent = (len(r.lists) - 1) * 2
+	}
+	r.blocks = append(r.blocks, textBlock{
+		prefix:   strings.Repeat("> ", r.quotes),
+		indent:   indent,
+		text:     text,
+		pre:      r.pre > 0,
+		listItem: len(r.lists) > 0,
+	})
+	if r.bullet != "" {
+		r.blocks[len(r.blocks)-1].prefix += r.bullet
+		r.bullet = ""
+	}
+}
+
+// render wraps the block to width, hanging continuation lines under the
+// first line's text rather than its bullet.
+func (b textBlock) render(width int) string {
+	first := strings.Repeat(" ", b.indent) + b.prefix
+	rest := strings.Repeat(" ", b.indent) + strings.Repeat(" ", len([]rune(b.prefix)))
+	if b.pre {
+		lines := strings.Split(b.text, "\n")
+		for i := range lines {
+			if i == 0 {
+				lines[i] = first + lines[i]
+			} else {
+				lines[i] = rest + lines[i]
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	available := width - len([]rune(first))
+	if available < 10 {
+		available = 10
+	}
+	var out strings.Builder
+	out.WriteString(first)
+	lineLength := 0
+	for _, word := range strings.Fields(b.text) {
+		wordLength := len([]rune(word))
+		if lineLength > 0 && lineLength+1+wordLength > available {
+			out.WriteString("\n")
+			out.WriteString(rest)
+			lineLength = 0
+		}
+		if lineLength > 0 {
+			out.WriteString(" ")
+			lineLength++
+		}
+		out.WriteString(word)
+		lineLength += wordLength
+	}
+	return out.String()
+}
+
+// Elements kept by sanitizeHTML, with the attributes each may carry.
+var allowedElements = map[atom.Atom][]string{
+	atom.A: {"href", "title"}, atom.Img: {"src", "alt", "title", "width", "height"},
+	atom.P: nil, atom.Br: nil, atom.Hr: nil, atom.Div: nil, atom.Span: nil,
+	atom.Em: nil, atom.Strong: nil, atom.B: nil, atom.I: nil, atom.U: nil, atom.S: nil,
+	atom.Sub: nil, atom.Sup: nil, atom.Small: nil, atom.Mark: nil,
+	atom.Code: nil, atom.Pre: nil, atom.Blockquote: {"cite"}, atom.Q: {"cite"},
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil, atom.Dl: nil, atom.Dt: nil, atom.Dd: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Table: nil, atom.Thead: nil, atom.Tbody: nil, atom.Tfoot: nil, atom.Tr: nil,
+	atom.Th: {"colspan", "rowspan"}, atom.Td: {"colspan", "rowspan"}, atom.Caption: nil,
+	atom.Figure: nil, atom.Figcaption: nil,
+}
+
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true}
+
+// sanitizeHTML reduces a post body to a safe subset of HTML for any HTML
+// outputs: scripts, styles and embeds are removed along with their contents,
+// unknown elements are unwrapped, and only http(s)/mailto/relative urls are kept.
+func sanitizeHTML(body string) string {
+	nodes, err := parseHTMLFragment(body)
+	if err != nil {
+		return html.EscapeString(body)
+	}
+	var out strings.Builder
+	for _, n := range nodes {
+		writeSanitized(&out, n)
+	}
+	return out.String()
+}
+
+func writeSanitized(out *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		out.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeSanitized(out, c)
+		}
+		return
+	}
+	if droppedElements[n.DataAtom] {
+		return
+	}
+	attributes, allowed := allowedElements[n.DataAtom]
+	if !allowed {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeSanitized(out, c)
+		}
+		return
+	}
+
+	out.WriteString("<" + n.Data)
+	for _, key := range attributes {
+		val := getAttr(n, key)
+		if val == "" || (urlAttributes[key] && !safeURL(val)) {
+			continue
+		}
+		fmt.Fprintf(out, ` %s="%s"`, key, html.EscapeString(val))
+	}
+	if n.DataAtom == atom.A {
+		out.WriteString(` rel="nofollow noopener noreferrer"`)
+	}
+	out.WriteString(">")
+	if n.DataAtom == atom.Br || n.DataAtom == atom.Hr || n.DataAtom == atom.Img {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeSanitized(out, c)
+	}
+	out.WriteString("</" + n.Data + ">")
+}
+
+func safeURL(link string) bool {
+	link = strings.ToLower(strings.TrimSpace(link))
+	i := strings.IndexAny(link, ":/?#")
+	if i < 0 || link[i] != ':' {
+		// No scheme, so a relative url
+		return true
+	}
+	switch link[:i] {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+const (
+	ruleActionMute      = "mute"
+	ruleActionHighlight = "highlight"
+)
+
+// Parts of a post a rule can be matched against.
+const (
+	ruleFieldAny      = "any"
+	ruleFieldTitle    = "title"
+	ruleFieldBody     = "body"
+	ruleFieldAuthor   = "author"
+	ruleFieldCategory = "category"
+)
+
+// ruleCandidate is the text of a post that rules are matched against.
+type ruleCandidate struct {
+	title      string
+	body       string
+	author     string
+	categories []string
+}
+
+func handlerRule(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("missing subcommand: rule add|list|remove")
+	}
+	subcommand := command{name: cmd.name + " " + cmd.args[0], args: cmd.args[1:]}
+	switch cmd.args[0] {
+	case "add":
+		return addRule(s, subcommand, loggedInUser)
+	case "list":
+		return listRules(s, loggedInUser)
+	case "remove":
+		return removeRule(s, subcommand, loggedInUser)
+	default:
+		return fmt.Errorf("unknown subcommand '%s': expected add, list or remove", cmd.args[0])
+	}
+}
+
+func addRule(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	isRegex := flags.Bool("regex", false, "treat the pattern as a regular expression instead of a keyword")
+	field := flags.String("field", ruleFieldAny, "part of the post to match: any, title, body, author or category")
+	feedUrl := flags.String("feed", "", "only apply the rule to the feed with this url")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("wrong number of arguments: expected 'rule add <mute|highlight> [flags] <pattern>'")
+	}
+	action, pattern := args[0], args[1]
+	if action != ruleActionMute && action != ruleActionHighlight {
+		return fmt.Errorf("argument %s not recognised: expected mute or highlight", action)
+	}
+	switch *field {
+	case ruleFieldAny, ruleFieldTitle, ruleFieldBody, ruleFieldAuthor, ruleFieldCategory:
+	default:
+		return fmt.Errorf("unknown field '%s': expected any, title, body, author or category", *field)
+	}
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("pattern must not be empty")
+	}
+	// Check the pattern before storing it, so a bad regex never reaches ingest
+	matcher, err := compileRule(database.Rule{Pattern: pattern, IsRegex: *isRegex})
+	if err != nil {
+		return err
+	}
+
+	params := database.CreateRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    loggedInUser.ID,
+		Action:    action,
+		Pattern:   pattern,
+		IsRegex:   *isRegex,
+		Field:     *field,
+	}
+	if *feedUrl != "" {
+		follow, err := s.dbq.GetFeedFollow(context.Background(), database.GetFeedFollowParams{
+			UserID: loggedInUser.ID,
+			Url:    *feedUrl,
+		})
+		if err != nil {
+			return fmt.Errorf("not following feed at '%s': %w", *feedUrl, err)
+		}
+		params.FeedID = uuid.NullUUID{UUID: follow.FeedID, Valid: true}
+	}
+	rule, err := s.dbq.CreateRule(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("unable to create rule: %w", err)
+	}
+
+	// Rules normally run at ingest, so apply the new one to posts already
+	// stored for the user's feeds
+	posts, err := s.dbq.GetRuleCandidatePosts(context.Background(), database.GetRuleCandidatePostsParams{
+		UserID: loggedInUser.ID,
+		FeedID: rule.FeedID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve posts to apply rule to: %w", err)
+	}
+	matched := 0
+	for _, post := range posts {
+		candidate := ruleCandidate{
+			title:      post.Title,
+			body:       htmlText(postBody(post.Description, post.Content)),
+			author:     post.Author,
+			categories: post.Categories,
+		}
+		if !matchRule(rule, matcher, candidate) {
+			continue
+		}
+		err = recordRuleMatch(s.dbq, context.Background(), rule, post.ID)
+		if err != nil {
+			return err
+		}
+		matched++
+	}
+	fmt.Printf("Added rule %s, matching %d existing posts\n", rule.ID, matched)
+	return nil
+}
+
+func listRules(s *state, loggedInUser database.User) error {
+	rules, err := s.dbq.GetRulesForUser(context.Background(), loggedInUser.ID)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve rules: %w", err)
+	}
+	if len(rules) == 0 {
+		fmt.Println("No rules")
+		return nil
+	}
+	for _, rule := range rules {
+		kind := "keyword"
+		if rule.IsRegex {
+			kind = "regex"
+		}
+		fmt.Printf("%s: %s %s '%s' in %s", rule.ID, rule.Action, kind, rule.Pattern, rule.Field)
+		if rule.FeedUrl.Valid {
+			fmt.Printf(" (feed: %s)", rule.FeedUrl.String)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func removeRule(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: rule remove <rule_id>")
+	}
+	id, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a rule id: %w", cmd.args[0], err)
+	}
+	removed, err := s.dbq.DeleteRule(context.Background(), database.DeleteRuleParams{
+		ID:     id,
+		UserID: loggedInUser.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to remove rule: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("no rule with id %s", id)
+	}
+	fmt.Printf("Removed rule %s\n", id)
+	return nil
+}
+
+// applyRules records a match for every rule of the feed's followers that the
+// new post satisfies, so reading commands only need to join on the result.
+func applyRules(post RSSItem, postID uuid.UUID, body string, feedEntry database.Feed, ctx context.Context, q *database.Queries) error {
+	rules, err := q.GetRulesForFeed(ctx, feedEntry.ID)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	candidate := ruleCandidate{
+		title:      post.Title,
+		body:       htmlText(body),
+		author:     postAuthor(post),
+		categories: post.Categories,
+	}
+	for _, rule := range rules {
+		matcher, err := compileRule(rule)
+		if err != nil {
+			// One broken rule shouldn't stop the post being stored
+			fmt.Printf("Skipping rule %s: %s\n", rule.ID, err)
+			continue
+		}
+		if !matchRule(rule, matcher, candidate) {
+			continue
+		}
+		err = recordRuleMatch(q, ctx, rule, postID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordRuleMatch(q *database.Queries, ctx context.Context, rule database.Rule, postID uuid.UUID) error {
+	err := q.CreatePostRuleMatch(ctx, database.CreatePostRuleMatchParams{
+		PostID:    postID,
+		RuleID:    rule.ID,
+		UserID:    rule.UserID,
+		Action:    rule.Action,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record rule match: %w", err)
+	}
+	return nil
+}
+
+// compileRule turns a rule's pattern into a case-insensitive matcher. Plain
+// keywords only match whole words, so 'go' doesn't match 'google'.
+func compileRule(rule database.Rule) (*regexp.Regexp, error) {
+	pattern := rule.Pattern
+	if !rule.IsRegex {
+		// Keywords match whole words, but a word boundary can only sit next to
+		// a word character, so keywords such as "C++" or "#golang" are only
+		// bounded on their word sides
+		pattern = regexp.QuoteMeta(rule.Pattern)
+		first, _ := utf8.DecodeRuneInString(rule.Pattern)
+		if isWordChar(first) {
+			pattern = `\b` + pattern
+		}
+		last, _ := utf8.DecodeLastRuneInString(rule.Pattern)
+		if isWordChar(last) {
+			pattern = pattern + `\b`
+		}
+	}
+	matcher, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", rule.Pattern, err)
+	}
+	return matcher, nil
+}
+
+// isWordChar reports whether r is a word character as regexp's \b sees it.
+func isWordChar(r rune) bool {
+	return r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+func matchRule(rule database.Rule, matcher *regexp.Regexp, post ruleCandidate) bool {
+	field := rule.Field
+	if (field == ruleFieldAny || field == ruleFieldTitle) && matcher.MatchString(post.title) {
+		return true
+	}
+	if (field == ruleFieldAny || field == ruleFieldBody) && matcher.MatchString(post.body) {
+		return true
+	}
+	if (field == ruleFieldAny || field == ruleFieldAuthor) && matcher.MatchString(post.author) {
+		return true
+	}
+	if field == ruleFieldAny || field == ruleFieldCategory {
+		for _, category := range post.categories {
+			if matcher.MatchString(category) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// htmlText returns the visible text of a post body, so rules don't match
+// markup or attribute values.
+func htmlText(body string) string {
+	nodes, err := parseHTMLFragment(body)
+	if err != nil {
+		return body
+	}
+	texts := []string{}
+	for _, n := range nodes {
+		if text := nodeText(n); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
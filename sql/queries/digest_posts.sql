@@ -0,0 +1,43 @@
+-- name: GetDigestPosts :many
+SELECT
+    posts.*,
+    COALESCE(feed_follows.display_title, feeds.name)::text AS feed_name
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND posts.created_at > sqlc.arg(since)
+    AND NOT feed_follows.muted
+    AND feed_follows.notify <> 'none'
+    AND (feed_follows.notify <> 'highlights' OR EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+            AND post_rule_matches.action = 'highlight'
+    ))
+    AND NOT EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+            AND post_rule_matches.action = 'mute'
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg(user_id)
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM digest_posts
+        WHERE digest_posts.post_id = posts.id AND digest_posts.user_id = sqlc.arg(user_id)
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM posts AS earlier
+        INNER JOIN feed_follows AS earlier_follows ON earlier.feed_id = earlier_follows.feed_id
+        WHERE earlier.cluster_id = posts.cluster_id
+            AND earlier_follows.user_id = sqlc.arg(user_id) AND NOT earlier_follows.muted
+            AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id)
+    )
+ORDER BY COALESCE(feed_follows.display_title, feeds.name) ASC, posts.feed_id ASC, posts.published_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: RecordDigestPosts :exec
+INSERT INTO digest_posts (user_id, post_id, sent_at)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(post_ids)::uuid[]), sqlc.arg(sent_at)
+ON CONFLICT (user_id, post_id) DO NOTHING;
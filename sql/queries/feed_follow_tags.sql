@@ -0,0 +1,30 @@
+-- name: AddFeedFollowTag :exec
+INSERT INTO feed_follow_tags (feed_follow_id, tag, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (feed_follow_id, tag) DO NOTHING;
+
+-- name: RemoveFeedFollowTag :execrows
+DELETE FROM feed_follow_tags
+WHERE feed_follow_id = $1 AND tag = $2;
+
+-- name: GetFollowingWithTags :many
+SELECT
+    feeds.id AS feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    feeds.title AS feed_title,
+    feeds.site_link,
+    feed_follows.display_title,
+    feed_follows.muted,
+    feed_follows.notify,
+    feed_follow_tags.tag
+FROM feed_follows
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+LEFT JOIN feed_follow_tags ON feed_follow_tags.feed_follow_id = feed_follows.id
+WHERE users.name = $1
+ORDER BY feed_follow_tags.tag ASC NULLS LAST, COALESCE(feed_follows.display_title, feeds.name) ASC, feeds.id ASC;
@@ -34,3 +34,13 @@ USING
     users AS u,
     feeds AS f
 WHERE u.name = $1 AND f.url = $2;
+
+-- name: GetFeedFollow :one
+SELECT feed_follows.* FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1 AND feeds.url = $2;
+
+-- name: UpdateFeedFollowSettings :exec
+UPDATE feed_follows
+SET display_title = $1, muted = $2, notify = $3, updated_at = $4
+WHERE id = $5;
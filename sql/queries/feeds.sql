@@ -17,6 +17,10 @@ SELECT * FROM feeds;
 SELECT * FROM feeds
 WHERE feeds.url = $1;
 
+-- name: GetFeed :one
+SELECT * FROM feeds
+WHERE feeds.id = $1;
+
 -- name: GetFeedUser :one
 SELECT users.name FROM users
 INNER JOIN feeds ON feeds.user_id = users.id
@@ -30,5 +34,50 @@ WHERE id = $2;
 -- name: GetNextFeedToFetch :one
 SELECT *
 FROM feeds
+WHERE NOT EXISTS (
+    SELECT 1 FROM websub_subscriptions
+    WHERE websub_subscriptions.feed_id = feeds.id
+        AND websub_subscriptions.state = 'active'
+        AND websub_subscriptions.lease_expires_at > sqlc.arg(now)::timestamp
+        AND feeds.last_fetched_at > sqlc.arg(poll_after)::timestamp
+)
 ORDER BY feeds.last_fetched_at ASC NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+LIMIT 1;
+
+-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET title = $1,
+    description = $2,
+    site_link = $3,
+    language = $4,
+    image_url = $5,
+    generator = $6,
+    last_fetch_status = $7,
+    updated_at = $8
+WHERE id = $9;
+
+-- name: SetFeedFetchStatus :exec
+UPDATE feeds
+SET last_fetch_status = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: GetFeedInfo :one
+SELECT
+    feeds.*,
+    users.name AS added_by,
+    (SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id) AS follower_count,
+    (SELECT COUNT(*) FROM posts WHERE posts.feed_id = feeds.id) AS post_count
+FROM feeds
+INNER JOIN users ON feeds.user_id = users.id
+WHERE feeds.url = $1;
+
+
+-- name: SetFeedFetchFullContent :exec
+UPDATE feeds
+SET fetch_full_content = $1, updated_at = $2
+WHERE url = $3;
+
+-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = $1, retention_max_posts = $2, updated_at = $3
+WHERE url = $4;
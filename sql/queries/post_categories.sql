@@ -0,0 +1,12 @@
+-- name: CreatePostCategory :exec
+INSERT INTO post_categories (post_id, category)
+VALUES (
+    $1,
+    $2
+)
+ON CONFLICT (post_id, category) DO NOTHING;
+
+-- name: GetPostCategories :many
+SELECT category FROM post_categories
+WHERE post_id = $1
+ORDER BY category ASC;
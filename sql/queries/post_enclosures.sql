@@ -0,0 +1,25 @@
+-- name: CreatePostEnclosure :one
+INSERT INTO post_enclosures (id, created_at, updated_at, post_id, url, mime_type, length, duration, episode, image_url)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+RETURNING *;
+
+-- name: GetPostEnclosures :many
+SELECT * FROM post_enclosures
+WHERE post_id = $1
+ORDER BY created_at ASC;
+
+-- name: MarkEnclosureDownloaded :exec
+UPDATE post_enclosures
+SET downloaded_path = $1, sha256 = $2, downloaded_at = $3, updated_at = $3
+WHERE id = $4;
@@ -0,0 +1,21 @@
+-- name: CreatePostMedia :exec
+INSERT INTO post_media (id, created_at, updated_at, post_id, kind, url, mime_type, medium, width, height, duration)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11
+)
+ON CONFLICT (post_id, kind, url) DO NOTHING;
+
+-- name: GetPostMedia :many
+SELECT * FROM post_media
+WHERE post_id = $1
+ORDER BY kind DESC, width DESC;
@@ -0,0 +1,23 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :exec
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: MarkPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT sqlc.arg(user_id)::uuid, posts.id, sqlc.arg(read_at)::timestamp
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE feed_follows.user_id = sqlc.arg(user_id)::uuid
+    AND (sqlc.narg(feed_url)::text IS NULL OR feeds.url = sqlc.narg(feed_url)::text)
+    AND (sqlc.narg(before)::timestamp IS NULL OR posts.published_at < sqlc.narg(before)::timestamp)
+ON CONFLICT (user_id, post_id) DO NOTHING;
@@ -1,5 +1,5 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, author, normalized_url, simhash, cluster_id, original_url)
 VALUES (
     $1, 
     $2,
@@ -8,13 +8,201 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13,
+    $14
 )
 RETURNING *;
 
+-- name: PostExists :one
+SELECT EXISTS (
+    SELECT 1 FROM posts
+    WHERE feed_id = sqlc.arg(feed_id) AND original_url = sqlc.arg(original_url)
+) OR EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE feed_id = sqlc.arg(feed_id) AND original_url = sqlc.arg(original_url)
+) AS stored;
+
+-- name: PostVisibleToUser :one
+SELECT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE user_id = sqlc.arg(user_id) AND feed_id = sqlc.arg(feed_id) AND NOT muted
+        AND notify <> 'none'
+        AND (notify <> 'highlights' OR EXISTS (
+            SELECT 1 FROM post_rule_matches
+            WHERE post_id = sqlc.arg(post_id) AND user_id = sqlc.arg(user_id) AND action = 'highlight'
+        ))
+) AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_id = sqlc.arg(post_id) AND user_id = sqlc.arg(user_id) AND action = 'mute'
+) AS visible;
+
 -- name: GetUserPosts :many
-SELECT posts.* FROM posts
+SELECT
+    posts.*,
+    COALESCE(feed_follows.display_title, feeds.name)::text AS feed_name,
+    EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+            AND post_rule_matches.action = 'highlight'
+    ) AS highlighted
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND (NOT sqlc.arg(unread_only)::bool OR NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg(user_id)
+    ))
+    AND (NOT sqlc.arg(starred_only)::bool OR EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = sqlc.arg(user_id)
+    ))
+    AND (sqlc.narg(feed)::text IS NULL OR feeds.url = sqlc.narg(feed)::text OR feeds.name = sqlc.narg(feed)::text
+        OR feed_follows.display_title = sqlc.narg(feed)::text)
+    AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+    AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until)::timestamp)
+    AND (sqlc.narg(author)::text IS NULL OR posts.author ILIKE '%' || sqlc.narg(author)::text || '%')
+    AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+        SELECT 1 FROM post_categories
+        WHERE post_categories.post_id = posts.id AND lower(post_categories.category) = lower(sqlc.narg(category)::text)
+    ))
+    AND (sqlc.narg(cursor_time)::timestamp IS NULL OR (
+        CASE WHEN sqlc.arg(sort)::text = 'fetched' THEN posts.created_at ELSE posts.published_at END,
+        posts.id
+    ) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid))
+    AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+        SELECT 1 FROM feed_follow_tags
+        WHERE feed_follow_tags.feed_follow_id = feed_follows.id AND feed_follow_tags.tag = sqlc.narg(tag)::text
+    ))
+    AND (NOT feed_follows.muted OR sqlc.narg(feed)::text IS NOT NULL)
+    AND (sqlc.narg(feed)::text IS NOT NULL OR NOT EXISTS (
+        SELECT 1 FROM posts AS earlier
+        INNER JOIN feed_follows AS earlier_follows ON earlier.feed_id = earlier_follows.feed_id
+        WHERE earlier.cluster_id = posts.cluster_id
+            AND earlier_follows.user_id = sqlc.arg(user_id) AND NOT earlier_follows.muted
+            AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id)
+            AND (NOT sqlc.arg(starred_only)::bool OR EXISTS (
+                SELECT 1 FROM post_stars
+                WHERE post_stars.post_id = earlier.id AND post_stars.user_id = sqlc.arg(user_id)
+            ))
+            AND (sqlc.narg(since)::timestamp IS NULL OR earlier.published_at >= sqlc.narg(since)::timestamp)
+            AND (sqlc.narg(until)::timestamp IS NULL OR earlier.published_at < sqlc.narg(until)::timestamp)
+            AND (sqlc.narg(author)::text IS NULL OR earlier.author ILIKE '%' || sqlc.narg(author)::text || '%')
+            AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+                SELECT 1 FROM post_categories
+                WHERE post_categories.post_id = earlier.id AND lower(post_categories.category) = lower(sqlc.narg(category)::text)
+            ))
+            AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+                SELECT 1 FROM feed_follow_tags
+                WHERE feed_follow_tags.feed_follow_id = earlier_follows.id AND feed_follow_tags.tag = sqlc.narg(tag)::text
+            ))
+            AND NOT EXISTS (
+                SELECT 1 FROM post_rule_matches
+                WHERE post_rule_matches.post_id = earlier.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+                    AND post_rule_matches.action = 'mute'
+            )
+            AND (NOT sqlc.arg(highlighted_only)::bool OR EXISTS (
+                SELECT 1 FROM post_rule_matches
+                WHERE post_rule_matches.post_id = earlier.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+                    AND post_rule_matches.action = 'highlight'
+            ))
+    ))
+    AND NOT EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+            AND post_rule_matches.action = 'mute'
+    )
+    AND (NOT sqlc.arg(highlighted_only)::bool OR EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+            AND post_rule_matches.action = 'highlight'
+    ))
+ORDER BY
+    CASE WHEN sqlc.arg(sort)::text = 'feed' THEN COALESCE(feed_follows.display_title, feeds.name) END ASC,
+    CASE WHEN sqlc.arg(sort)::text = 'feed' THEN feeds.id END ASC,
+    CASE WHEN sqlc.arg(sort)::text = 'fetched' THEN posts.created_at ELSE posts.published_at END DESC,
+    posts.id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: GetPost :one
+SELECT * FROM posts
+WHERE id = $1;
+
+-- name: UpdatePostContent :exec
+UPDATE posts
+SET content = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: SearchPosts :many
+SELECT
+    posts.*,
+    feeds.name AS feed_name,
+    ts_rank(posts.search_vector, websearch_to_tsquery('english', sqlc.arg(query)::text)) AS rank
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.search_vector @@ websearch_to_tsquery('english', sqlc.arg(query)::text)
+    AND (sqlc.arg(all_feeds)::bool OR EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = sqlc.arg(user_id)
+            AND NOT feed_follows.muted
+    ))
+    AND NOT EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = posts.id AND post_rule_matches.user_id = sqlc.arg(user_id)
+            AND post_rule_matches.action = 'mute'
+    )
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: FindPostCluster :one
+SELECT cluster_id FROM posts
+WHERE id <> sqlc.arg(id)
+    AND (
+        (sqlc.arg(normalized_url)::text <> '' AND normalized_url = sqlc.arg(normalized_url)::text)
+        OR (sqlc.arg(simhash)::bigint <> 0 AND simhash <> 0 AND created_at > sqlc.arg(since)
+            AND bit_count((simhash # sqlc.arg(simhash)::bigint)::bit(64)) <= sqlc.arg(max_distance)::int)
+    )
+ORDER BY normalized_url = sqlc.arg(normalized_url)::text DESC, created_at ASC, id ASC
+LIMIT 1;
+
+-- name: SetPostCluster :exec
+UPDATE posts
+SET cluster_id = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: GetPostsWithoutNormalizedURL :many
+SELECT id, created_at, url FROM posts
+WHERE normalized_url = ''
+    AND (created_at, id) > (sqlc.arg(after_created_at)::timestamp, sqlc.arg(after_id)::uuid)
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
+-- name: SetPostNormalizedURL :exec
+UPDATE posts
+SET normalized_url = sqlc.arg(normalized_url),
+    cluster_id = COALESCE((
+        SELECT earlier.cluster_id FROM posts AS earlier
+        WHERE earlier.normalized_url = sqlc.arg(normalized_url)
+            AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id)
+        ORDER BY earlier.created_at, earlier.id
+        LIMIT 1
+    ), cluster_id),
+    updated_at = sqlc.arg(updated_at)
+WHERE id = sqlc.arg(id);
+
+-- name: GetClusterSources :many
+SELECT
+    posts.id,
+    posts.url,
+    COALESCE(feed_follows.display_title, feeds.name)::text AS feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
 INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+WHERE posts.cluster_id = sqlc.arg(cluster_id) AND feed_follows.user_id = sqlc.arg(user_id)
+ORDER BY posts.created_at ASC, posts.id ASC;
@@ -0,0 +1,60 @@
+-- name: ForgetPrunedPosts :exec
+DELETE FROM pruned_posts
+WHERE feed_id = sqlc.arg(feed_id) AND NOT (original_url = ANY(sqlc.arg(current_urls)::text[]));
+
+-- name: GetPrunablePosts :many
+WITH ranked AS (
+    SELECT
+        posts.id,
+        row_number() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position
+    FROM posts
+    WHERE NOT EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id
+    )
+)
+SELECT
+    posts.id,
+    posts.title,
+    posts.url,
+    posts.created_at,
+    feeds.name AS feed_name
+FROM posts
+INNER JOIN ranked ON ranked.id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE (
+        posts.created_at < CASE
+            WHEN feeds.retention_max_age_days IS NULL THEN sqlc.narg(max_age_cutoff)::timestamp
+            WHEN feeds.retention_max_age_days > 0 THEN sqlc.arg(now)::timestamp - make_interval(days => feeds.retention_max_age_days)
+        END
+        OR ranked.position > CASE
+            WHEN feeds.retention_max_posts IS NULL THEN sqlc.narg(max_posts)::int
+            WHEN feeds.retention_max_posts > 0 THEN feeds.retention_max_posts
+        END
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id
+    )
+    AND NOT (posts.created_at > sqlc.arg(keep_unread_since)::timestamp AND EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.feed_id = posts.feed_id
+            AND NOT EXISTS (
+                SELECT 1 FROM post_reads
+                WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+            )
+    ))
+ORDER BY feeds.name ASC, posts.created_at ASC;
+
+-- name: PrunePosts :exec
+WITH pruned AS (
+    DELETE FROM posts
+    WHERE posts.id = ANY(sqlc.arg(ids)::uuid[])
+    RETURNING posts.feed_id, posts.original_url
+)
+INSERT INTO pruned_posts (feed_id, original_url, pruned_at)
+SELECT pruned.feed_id, pruned.original_url, sqlc.arg(pruned_at)::timestamp FROM pruned
+ON CONFLICT (feed_id, original_url) DO NOTHING;
@@ -0,0 +1,70 @@
+-- name: CreateRule :one
+INSERT INTO rules (id, created_at, updated_at, user_id, action, pattern, is_regex, field, feed_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+)
+RETURNING *;
+
+-- name: GetRulesForUser :many
+SELECT
+    rules.*,
+    feeds.url AS feed_url
+FROM rules
+LEFT JOIN feeds ON rules.feed_id = feeds.id
+WHERE rules.user_id = $1
+ORDER BY rules.created_at ASC;
+
+-- name: GetRulesForFeed :many
+SELECT rules.* FROM rules
+WHERE (rules.feed_id IS NULL OR rules.feed_id = sqlc.arg(feed_id))
+    AND EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.user_id = rules.user_id AND feed_follows.feed_id = sqlc.arg(feed_id)
+    );
+
+-- name: DeleteRule :execrows
+DELETE FROM rules
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreatePostRuleMatch :exec
+INSERT INTO post_rule_matches (post_id, rule_id, user_id, action, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (post_id, rule_id) DO NOTHING;
+
+-- name: GetRuleCandidatePosts :many
+SELECT
+    posts.id,
+    posts.title,
+    posts.description,
+    posts.content,
+    posts.author,
+    COALESCE(
+        array_agg(post_categories.category) FILTER (WHERE post_categories.category IS NOT NULL),
+        '{}'
+    )::text[] AS categories
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_categories ON post_categories.post_id = posts.id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+GROUP BY posts.id;
+
+-- name: GetMatchedRules :many
+SELECT rules.* FROM rules
+INNER JOIN post_rule_matches ON post_rule_matches.rule_id = rules.id
+WHERE post_rule_matches.post_id = $1 AND post_rule_matches.user_id = $2
+ORDER BY rules.created_at ASC;
@@ -17,3 +17,19 @@ DELETE FROM users;
 
 -- name: GetUsers :many
 SELECT * FROM users;
+
+
+-- name: SetUserDigest :exec
+UPDATE users
+SET email = $1, digest_frequency = $2, updated_at = $3
+WHERE id = $4;
+
+-- name: GetDigestSubscribers :many
+SELECT * FROM users
+WHERE digest_frequency <> 'off' AND email IS NOT NULL
+ORDER BY name ASC;
+
+-- name: SetUserLastDigest :exec
+UPDATE users
+SET last_digest_at = $1
+WHERE id = $2;
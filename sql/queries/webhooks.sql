@@ -0,0 +1,68 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, feed_id, url, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhooksForUser :many
+SELECT
+    webhooks.*,
+    feeds.url AS feed_url
+FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.created_at ASC;
+
+-- name: GetWebhooksForPost :many
+SELECT webhooks.* FROM webhooks
+INNER JOIN feed_follows ON feed_follows.user_id = webhooks.user_id
+    AND feed_follows.feed_id = sqlc.arg(feed_id)
+WHERE (webhooks.feed_id IS NULL OR webhooks.feed_id = sqlc.arg(feed_id))
+    AND NOT feed_follows.muted
+    AND feed_follows.notify <> 'none'
+    AND (feed_follows.notify <> 'highlights' OR EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = sqlc.arg(post_id) AND post_rule_matches.user_id = webhooks.user_id
+            AND post_rule_matches.action = 'highlight'
+    ))
+    AND NOT EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.post_id = sqlc.arg(post_id) AND post_rule_matches.user_id = webhooks.user_id
+            AND post_rule_matches.action = 'mute'
+    );
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, webhook_id, delivery_id, post_id, event, attempt, status_code, error, duration_ms, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+);
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
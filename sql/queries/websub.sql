@@ -0,0 +1,46 @@
+-- name: UpsertWebSubSubscription :one
+INSERT INTO websub_subscriptions (feed_id, created_at, updated_at, hub_url, topic_url, secret, state)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    'pending'
+)
+ON CONFLICT (feed_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+    hub_url = EXCLUDED.hub_url,
+    topic_url = EXCLUDED.topic_url,
+    secret = EXCLUDED.secret,
+    state = 'pending'
+RETURNING *;
+
+-- name: DeleteWebSubSubscription :execrows
+DELETE FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: GetWebSubSubscription :one
+SELECT * FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT * FROM websub_subscriptions
+WHERE (state = 'active' AND lease_expires_at < sqlc.arg(renew_before)::timestamp)
+    OR (state <> 'active' AND updated_at < sqlc.arg(retry_before));
+
+-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET state = 'active', lease_expires_at = $1, updated_at = $2
+WHERE feed_id = $3;
+
+-- name: SetWebSubSubscriptionState :exec
+UPDATE websub_subscriptions
+SET state = $1, updated_at = $2
+WHERE feed_id = $3;
+
+-- name: MarkWebSubPush :exec
+UPDATE websub_subscriptions
+SET last_push_at = $1
+WHERE feed_id = $2;
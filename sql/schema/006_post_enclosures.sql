@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE post_enclosures (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    length BIGINT NOT NULL,
+    duration TEXT NOT NULL,
+    episode TEXT NOT NULL,
+    image_url TEXT NOT NULL,
+    downloaded_path TEXT,
+    sha256 TEXT,
+    downloaded_at TIMESTAMP,
+    UNIQUE (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE post_enclosures;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE post_media (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    url TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    medium TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    duration INTEGER NOT NULL,
+    UNIQUE (post_id, kind, url)
+);
+
+-- +goose Down
+DROP TABLE post_media;
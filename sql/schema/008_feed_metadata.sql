@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD title TEXT NOT NULL DEFAULT '',
+    ADD description TEXT NOT NULL DEFAULT '',
+    ADD site_link TEXT NOT NULL DEFAULT '',
+    ADD language TEXT NOT NULL DEFAULT '',
+    ADD image_url TEXT NOT NULL DEFAULT '',
+    ADD generator TEXT NOT NULL DEFAULT '',
+    ADD last_fetch_status TEXT;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN title,
+    DROP COLUMN description,
+    DROP COLUMN site_link,
+    DROP COLUMN language,
+    DROP COLUMN image_url,
+    DROP COLUMN generator,
+    DROP COLUMN last_fetch_status;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE posts
+    ADD author TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE post_categories (
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    category TEXT NOT NULL,
+    PRIMARY KEY (post_id, category)
+);
+
+CREATE INDEX post_categories_category_idx ON post_categories (lower(category));
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
+
+-- +goose Down
+DROP INDEX posts_feed_id_published_at_idx;
+
+DROP TABLE post_categories;
+
+ALTER TABLE posts
+    DROP COLUMN author;
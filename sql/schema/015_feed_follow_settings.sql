@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE feed_follows
+    ADD display_title TEXT,
+    ADD muted BOOLEAN NOT NULL DEFAULT false,
+    ADD notify TEXT NOT NULL DEFAULT 'all';
+
+-- +goose Down
+ALTER TABLE feed_follows
+    DROP COLUMN display_title,
+    DROP COLUMN muted,
+    DROP COLUMN notify;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE rules (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    is_regex BOOLEAN NOT NULL,
+    field TEXT NOT NULL,
+    feed_id UUID REFERENCES feeds (id) ON DELETE CASCADE
+);
+
+CREATE TABLE post_rule_matches (
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    rule_id UUID NOT NULL REFERENCES rules (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, rule_id)
+);
+
+CREATE INDEX post_rule_matches_user_id_post_id_idx ON post_rule_matches (user_id, post_id);
+
+-- +goose Down
+DROP TABLE post_rule_matches;
+DROP TABLE rules;
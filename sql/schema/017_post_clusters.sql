@@ -0,0 +1,40 @@
+-- +goose Up
+-- The same story may now arrive from several feeds, so urls only need to be
+-- unique within a feed. Duplicates are grouped by cluster_id instead.
+ALTER TABLE posts
+    DROP CONSTRAINT posts_url_key,
+    ADD normalized_url TEXT NOT NULL DEFAULT '',
+    ADD simhash BIGINT NOT NULL DEFAULT 0,
+    ADD cluster_id UUID,
+    ADD UNIQUE (feed_id, url);
+
+-- Existing posts are left with an empty normalized_url, and each in a
+-- cluster of its own. The aggregator normalizes their links with
+-- normalizeURL when it starts, so they match new copies exactly, and groups
+-- them with earlier copies then.
+UPDATE posts SET cluster_id = id WHERE cluster_id IS NULL;
+
+ALTER TABLE posts
+    ALTER cluster_id SET NOT NULL;
+
+CREATE INDEX posts_normalized_url_idx ON posts (normalized_url);
+CREATE INDEX posts_cluster_id_idx ON posts (cluster_id);
+
+-- +goose Down
+DROP INDEX posts_cluster_id_idx;
+DROP INDEX posts_normalized_url_idx;
+
+-- Keep only the first copy of each url so it can be unique again
+DELETE FROM posts
+WHERE EXISTS (
+    SELECT 1 FROM posts AS other
+    WHERE other.url = posts.url
+        AND (other.created_at, other.id) < (posts.created_at, posts.id)
+);
+
+ALTER TABLE posts
+    DROP CONSTRAINT posts_feed_id_url_key,
+    DROP COLUMN normalized_url,
+    DROP COLUMN simhash,
+    DROP COLUMN cluster_id,
+    ADD UNIQUE (url);
@@ -0,0 +1,15 @@
+-- +goose Up
+-- url now holds the canonical link, with the link as published kept here
+ALTER TABLE posts
+    ADD original_url TEXT NOT NULL DEFAULT '';
+
+UPDATE posts SET original_url = url;
+
+-- Every fetched item is looked up by its published link
+CREATE INDEX posts_feed_id_original_url_idx ON posts (feed_id, original_url);
+
+-- +goose Down
+DROP INDEX posts_feed_id_original_url_idx;
+
+ALTER TABLE posts
+    DROP COLUMN original_url;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Per-feed overrides of the configured retention policy. NULL uses the
+-- global setting and 0 turns the limit off for the feed.
+ALTER TABLE feeds
+    ADD retention_max_age_days INTEGER,
+    ADD retention_max_posts INTEGER;
+
+-- Links of pruned posts, so they aren't stored again while they are still in
+-- the feed
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    original_url TEXT NOT NULL,
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, original_url)
+);
+
+-- +goose Down
+DROP TABLE pruned_posts;
+
+ALTER TABLE feeds
+    DROP COLUMN retention_max_age_days,
+    DROP COLUMN retention_max_posts;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+    ADD email TEXT,
+    ADD digest_frequency TEXT NOT NULL DEFAULT 'off',
+    ADD last_digest_at TIMESTAMP;
+
+-- Posts already sent to a user in an email digest
+CREATE TABLE digest_posts (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE digest_posts;
+
+ALTER TABLE users
+    DROP COLUMN email,
+    DROP COLUMN digest_frequency,
+    DROP COLUMN last_digest_at;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- A webhook with no feed_id is called for posts from all of the user's
+-- followed feeds
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    feed_id UUID REFERENCES feeds (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL
+);
+
+-- One row per delivery attempt. status_code is NULL when no response was
+-- received, and post_id is NULL for test deliveries.
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    delivery_id UUID NOT NULL,
+    post_id UUID REFERENCES posts (id) ON DELETE SET NULL,
+    event TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER,
+    error TEXT NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_created_at_idx ON webhook_deliveries (webhook_id, created_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- A feed's WebSub subscription. state is pending until the hub verifies the
+-- subscription, then active until lease_expires_at; denied if the hub
+-- refused it.
+CREATE TABLE websub_subscriptions (
+    feed_id UUID PRIMARY KEY REFERENCES feeds (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    hub_url TEXT NOT NULL,
+    topic_url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    state TEXT NOT NULL,
+    lease_expires_at TIMESTAMP,
+    last_push_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE websub_subscriptions;
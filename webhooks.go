@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+const (
+	webhookEventNewPost = "post.created"
+	webhookEventPing    = "ping"
+)
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 5
+	// Doubled after each failed attempt, so a delivery is retried over about
+	// two and a half minutes
+	webhookRetryDelay = 10 * time.Second
+	// Deliveries run on this many workers, with at most webhookQueueSize
+	// waiting for one
+	webhookWorkers   = 4
+	webhookQueueSize = 1000
+)
+
+// webhookPayload is the JSON body posted to webhooks. Feed and Post are left
+// out of pings.
+type webhookPayload struct {
+	Event        string        `json:"event"`
+	DeliveryID   uuid.UUID     `json:"delivery_id"`
+	WebhookID    uuid.UUID     `json:"webhook_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Feed         *webhookFeed  `json:"feed,omitempty"`
+	Post         *webhookPost  `json:"post,omitempty"`
+	MatchedRules []webhookRule `json:"matched_rules"`
+}
+
+type webhookFeed struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Url      string    `json:"url"`
+	Title    string    `json:"title"`
+	SiteLink string    `json:"site_link"`
+}
+
+type webhookPost struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Url         string     `json:"url"`
+	OriginalUrl string     `json:"original_url"`
+	Author      string     `json:"author"`
+	PublishedAt *time.Time `json:"published_at"`
+	Description string     `json:"description"`
+	// The full article where it was fetched, otherwise the feed's content
+	// or description
+	Content    string             `json:"content"`
+	Categories []string           `json:"categories"`
+	Enclosures []webhookEnclosure `json:"enclosures"`
+	Media      []webhookMedia     `json:"media"`
+}
+
+type webhookEnclosure struct {
+	Url      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	// 0 when the feed doesn't give a length
+	Length   int64  `json:"length"`
+	Duration string `json:"duration"`
+	Episode  string `json:"episode"`
+	ImageUrl string `json:"image_url"`
+}
+
+type webhookMedia struct {
+	Kind     string `json:"kind"`
+	Url      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Medium   string `json:"medium"`
+	Width    int32  `json:"width"`
+	Height   int32  `json:"height"`
+	Duration int32  `json:"duration"`
+}
+
+type webhookRule struct {
+	ID      uuid.UUID `json:"id"`
+	Action  string    `json:"action"`
+	Pattern string    `json:"pattern"`
+	IsRegex bool      `json:"is_regex"`
+	Field   string    `json:"field"`
+}
+
+func handlerWebhook(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("missing subcommand: webhook add|list|remove|test|log")
+	}
+	subcommand := command{name: cmd.name + " " + cmd.args[0], args: cmd.args[1:]}
+	switch cmd.args[0] {
+	case "add":
+		return addWebhook(s, subcommand, loggedInUser)
+	case "list":
+		return listWebhooks(s, loggedInUser)
+	case "remove":
+		return removeWebhook(s, subcommand, loggedInUser)
+	case "test":
+		return testWebhook(s, subcommand, loggedInUser)
+	case "log":
+		return webhookLog(s, subcommand, loggedInUser)
+	default:
+		return fmt.Errorf("unknown subcommand '%s': expected add, list, remove, test or log", cmd.args[0])
+	}
+}
+
+func addWebhook(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	feedUrl := flags.String("feed", "", "only call the webhook for posts from the feed with this url")
+	secret := flags.String("secret", "", "secret used to sign deliveries (generated if not given)")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: webhook add [--feed <feed_url>] [--secret <secret>] <url>")
+	}
+	target, err := url.Parse(args[0])
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("argument %s not recognised as an http or https url", args[0])
+	}
+	if *secret == "" {
+		key := make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return fmt.Errorf("unable to generate secret: %w", err)
+		}
+		*secret = hex.EncodeToString(key)
+	}
+
+	params := database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    loggedInUser.ID,
+		Url:       target.String(),
+		Secret:    *secret,
+	}
+	if *feedUrl != "" {
+		follow, err := s.dbq.GetFeedFollow(context.Background(), database.GetFeedFollowParams{
+			UserID: loggedInUser.ID,
+			Url:    *feedUrl,
+		})
+		if err != nil {
+			return fmt.Errorf("not following feed at '%s': %w", *feedUrl, err)
+		}
+		params.FeedID = uuid.NullUUID{UUID: follow.FeedID, Valid: true}
+	}
+	webhook, err := s.dbq.CreateWebhook(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("unable to create webhook: %w", err)
+	}
+	fmt.Printf("Added webhook %s\n", webhook.ID)
+	fmt.Printf("Signing secret: %s\n", webhook.Secret)
+	return nil
+}
+
+func listWebhooks(s *state, loggedInUser database.User) error {
+	webhooks, err := s.dbq.GetWebhooksForUser(context.Background(), loggedInUser.ID)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		fmt.Println("No webhooks")
+		return nil
+	}
+	for _, webhook := range webhooks {
+		scope := "all followed feeds"
+		if webhook.FeedUrl.Valid {
+			scope = "feed: " + webhook.FeedUrl.String
+		}
+		fmt.Printf("%s: %s (%s)\n", webhook.ID, webhook.Url, scope)
+	}
+	return nil
+}
+
+func removeWebhook(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: webhook remove <webhook_id>")
+	}
+	id, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("argument %s not recognised as a webhook id: %w", cmd.args[0], err)
+	}
+	removed, err := s.dbq.DeleteWebhook(context.Background(), database.DeleteWebhookParams{
+		ID:     id,
+		UserID: loggedInUser.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to remove webhook: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("no webhook with id %s", id)
+	}
+	fmt.Printf("Removed webhook %s\n", id)
+	return nil
+}
+
+// testWebhook sends a ping to the webhook once, without retrying, and
+// reports the response.
+func testWebhook(s *state, cmd command, loggedInUser database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("expected one argument: webhook test <webhook_id>")
+	}
+	webhook, err := findWebhook(s, cmd.args[0], loggedInUser)
+	if err != nil {
+		return err
+	}
+	payload := webhookPayload{
+		Event:        webhookEventPing,
+		DeliveryID:   uuid.New(),
+		WebhookID:    webhook.ID,
+		CreatedAt:    time.Now(),
+		MatchedRules: []webhookRule{},
+	}
+	status, err := deliverWebhook(context.Background(), s, webhook, payload, 1)
+	if err != nil {
+		return fmt.Errorf("webhook test failed: %w", err)
+	}
+	fmt.Printf("Webhook responded with %d %s\n", status, http.StatusText(status))
+	return nil
+}
+
+func webhookLog(s *state, cmd command, loggedInUser database.User) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "number of delivery attempts to show")
+	args, err := parseFlags(flags, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one argument: webhook log [--limit <n>] <webhook_id>")
+	}
+	webhook, err := findWebhook(s, args[0], loggedInUser)
+	if err != nil {
+		return err
+	}
+	deliveries, err := s.dbq.GetWebhookDeliveries(context.Background(), database.GetWebhookDeliveriesParams{
+		WebhookID: webhook.ID,
+		Limit:     int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve webhook deliveries: %w", err)
+	}
+	if len(deliveries) == 0 {
+		fmt.Println("No deliveries")
+		return nil
+	}
+	for _, delivery := range deliveries {
+		result := delivery.Error
+		if delivery.StatusCode.Valid {
+			result = fmt.Sprintf("%d %s", delivery.StatusCode.Int32, http.StatusText(int(delivery.StatusCode.Int32)))
+		}
+		fmt.Printf("%s %s %s attempt %d: %s (%dms)\n", delivery.CreatedAt.Format(time.DateTime), delivery.DeliveryID,
+			delivery.Event, delivery.Attempt, result, delivery.DurationMs)
+	}
+	return nil
+}
+
+func findWebhook(s *state, id string, loggedInUser database.User) (database.Webhook, error) {
+	webhookID, err := uuid.Parse(id)
+	if err != nil {
+		return database.Webhook{}, fmt.Errorf("argument %s not recognised as a webhook id: %w", id, err)
+	}
+	webhook, err := s.dbq.GetWebhook(context.Background(), database.GetWebhookParams{
+		ID:     webhookID,
+		UserID: loggedInUser.ID,
+	})
+	if err != nil {
+		return database.Webhook{}, fmt.Errorf("no webhook with id %s: %w", webhookID, err)
+	}
+	return webhook, nil
+}
+
+// webhookDispatcher delivers webhooks in the background on a fixed number of
+// workers, so a slow or failing endpoint doesn't hold up collecting feeds.
+type webhookDispatcher struct {
+	s      *state
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan webhookDelivery
+	wg     sync.WaitGroup
+	// Guards queue against sends once it is closed
+	mu     sync.Mutex
+	closed bool
+}
+
+type webhookDelivery struct {
+	webhook database.Webhook
+	payload webhookPayload
+}
+
+func startWebhookDispatcher(s *state) *webhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatcher := &webhookDispatcher{
+		s:      s,
+		ctx:    ctx,
+		cancel: cancel,
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+	}
+	for range webhookWorkers {
+		dispatcher.wg.Add(1)
+		go func() {
+			defer dispatcher.wg.Done()
+			for delivery := range dispatcher.queue {
+				dispatcher.deliver(delivery)
+			}
+		}()
+	}
+	return dispatcher
+}
+
+// enqueue queues a delivery. When the queue is full, or the dispatcher has
+// stopped, the delivery is logged as failed instead.
+func (dispatcher *webhookDispatcher) enqueue(delivery webhookDelivery) {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	if dispatcher.closed {
+		dispatcher.fail(delivery, "not delivered: aggregator stopped")
+		return
+	}
+	select {
+	case dispatcher.queue <- delivery:
+	default:
+		dispatcher.fail(delivery, "not delivered: too many deliveries waiting")
+	}
+}
+
+func (dispatcher *webhookDispatcher) deliver(delivery webhookDelivery) {
+	if dispatcher.ctx.Err() != nil {
+		dispatcher.fail(delivery, "not delivered: aggregator stopped")
+		return
+	}
+	_, err := deliverWebhook(dispatcher.ctx, dispatcher.s, delivery.webhook, delivery.payload, webhookMaxAttempts)
+	if err != nil {
+		fmt.Printf("Unable to deliver webhook to <%s>: %s\n", delivery.webhook.Url, err)
+	}
+}
+
+// fail logs a delivery that was never attempted, so it shows up in the
+// webhook's log.
+func (dispatcher *webhookDispatcher) fail(delivery webhookDelivery, reason string) {
+	fmt.Printf("Unable to deliver webhook to <%s>: %s\n", delivery.webhook.Url, reason)
+	params := database.CreateWebhookDeliveryParams{
+		ID:         uuid.New(),
+		WebhookID:  delivery.webhook.ID,
+		DeliveryID: delivery.payload.DeliveryID,
+		Event:      delivery.payload.Event,
+		Attempt:    0,
+		Error:      reason,
+		CreatedAt:  time.Now(),
+	}
+	if delivery.payload.Post != nil {
+		params.PostID = uuid.NullUUID{UUID: delivery.payload.Post.ID, Valid: true}
+	}
+	err := dispatcher.s.dbq.CreateWebhookDelivery(context.Background(), params)
+	if err != nil {
+		fmt.Printf("Unable to log webhook delivery: %s\n", err)
+	}
+}
+
+// stop cancels deliveries in progress, logs the ones still waiting as failed
+// and waits for the workers to finish.
+func (dispatcher *webhookDispatcher) stop() {
+	dispatcher.mu.Lock()
+	dispatcher.closed = true
+	close(dispatcher.queue)
+	dispatcher.mu.Unlock()
+	dispatcher.cancel()
+	dispatcher.wg.Wait()
+}
+
+// notifyWebhooks queues calls to the webhooks of the feed's followers for a
+// new post. It does nothing outside the aggregator.
+func notifyWebhooks(post RSSItem, newPost database.Post, body string, feedEntry database.Feed, ctx context.Context, s *state) error {
+	if s.webhooks == nil {
+		return nil
+	}
+	webhooks, err := s.dbq.GetWebhooksForPost(ctx, database.GetWebhooksForPostParams{
+		FeedID: feedEntry.ID,
+		PostID: newPost.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	item := newWebhookPost(post, newPost, body)
+	feed := newWebhookFeed(feedEntry)
+	for _, webhook := range webhooks {
+		rules, err := s.dbq.GetMatchedRules(ctx, database.GetMatchedRulesParams{
+			PostID: newPost.ID,
+			UserID: webhook.UserID,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to retrieve matched rules: %w", err)
+		}
+		payload := webhookPayload{
+			Event:        webhookEventNewPost,
+			DeliveryID:   uuid.New(),
+			WebhookID:    webhook.ID,
+			CreatedAt:    time.Now(),
+			Feed:         &feed,
+			Post:         &item,
+			MatchedRules: newWebhookRules(rules),
+		}
+		s.webhooks.enqueue(webhookDelivery{webhook: webhook, payload: payload})
+	}
+	return nil
+}
+
+func newWebhookPost(post RSSItem, newPost database.Post, body string) webhookPost {
+	item := webhookPost{
+		ID:          newPost.ID,
+		Title:       newPost.Title,
+		Url:         newPost.Url,
+		OriginalUrl: newPost.OriginalUrl,
+		Author:      newPost.Author,
+		Description: newPost.Description,
+		Content:     body,
+		Categories:  []string{},
+		Enclosures:  []webhookEnclosure{},
+		Media:       []webhookMedia{},
+	}
+	// Posts with an unparseable date are stored with the zero time
+	if newPost.PublishedAt.Valid && !newPost.PublishedAt.Time.IsZero() {
+		item.PublishedAt = &newPost.PublishedAt.Time
+	}
+	for _, category := range post.Categories {
+		if category = strings.TrimSpace(category); category != "" {
+			item.Categories = append(item.Categories, category)
+		}
+	}
+	for _, enclosure := range post.Enclosures {
+		if enclosure.Url == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		item.Enclosures = append(item.Enclosures, webhookEnclosure{
+			Url:      enclosure.Url,
+			MimeType: enclosure.Type,
+			Length:   length,
+			Duration: post.Duration,
+			Episode:  post.Episode,
+			ImageUrl: post.Image.Href,
+		})
+	}
+	for _, medium := range postMediaParams(post) {
+		item.Media = append(item.Media, webhookMedia{
+			Kind:     medium.Kind,
+			Url:      medium.Url,
+			MimeType: medium.MimeType,
+			Medium:   medium.Medium,
+			Width:    medium.Width,
+			Height:   medium.Height,
+			Duration: medium.Duration,
+		})
+	}
+	return item
+}
+
+func newWebhookFeed(feedEntry database.Feed) webhookFeed {
+	return webhookFeed{
+		ID:       feedEntry.ID,
+		Name:     feedEntry.Name,
+		Url:      feedEntry.Url,
+		Title:    feedEntry.Title,
+		SiteLink: feedEntry.SiteLink,
+	}
+}
+
+func newWebhookRules(rules []database.Rule) []webhookRule {
+	matched := []webhookRule{}
+	for _, rule := range rules {
+		matched = append(matched, webhookRule{
+			ID:      rule.ID,
+			Action:  rule.Action,
+			Pattern: rule.Pattern,
+			IsRegex: rule.IsRegex,
+			Field:   rule.Field,
+		})
+	}
+	return matched
+}
+
+// deliverWebhook posts the payload to the webhook, retrying failures with
+// exponential backoff, and logs every attempt. It returns the status code of
+// the last response.
+func deliverWebhook(ctx context.Context, s *state, webhook database.Webhook, payload webhookPayload, maxAttempts int) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("unable to encode payload: %w", err)
+	}
+	postID := uuid.NullUUID{}
+	if payload.Post != nil {
+		postID = uuid.NullUUID{UUID: payload.Post.ID, Valid: true}
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		status, err := sendWebhook(ctx, webhook, payload, body)
+		delivery := database.CreateWebhookDeliveryParams{
+			ID:         uuid.New(),
+			WebhookID:  webhook.ID,
+			DeliveryID: payload.DeliveryID,
+			PostID:     postID,
+			Event:      payload.Event,
+			Attempt:    int32(attempt),
+			DurationMs: int32(time.Since(started).Milliseconds()),
+			CreatedAt:  time.Now(),
+		}
+		if status != 0 {
+			delivery.StatusCode = sql.NullInt32{Int32: int32(status), Valid: true}
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		// Attempts are logged even when delivery was cancelled
+		logErr := s.dbq.CreateWebhookDelivery(context.WithoutCancel(ctx), delivery)
+		if logErr != nil {
+			return status, fmt.Errorf("unable to log webhook delivery: %w", logErr)
+		}
+
+		if err == nil {
+			return status, nil
+		}
+		if attempt >= maxAttempts || !retryableWebhookStatus(status) {
+			return status, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return status, err
+		}
+		delay *= 2
+	}
+}
+
+// sendWebhook makes one delivery attempt. The body is signed with the
+// webhook's secret using HMAC-SHA256, so receivers can check it came from
+// gator.
+func sendWebhook(ctx context.Context, webhook database.Webhook, payload webhookPayload, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "POST", webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("User-Agent", "gator")
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Gator-Event", payload.Event)
+	request.Header.Set("X-Gator-Delivery", payload.DeliveryID.String())
+	request.Header.Set("X-Gator-Signature-256", "sha256="+signPayload(webhook.Secret, body))
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryableWebhookStatus reports whether a failed attempt is worth retrying:
+// network errors (status 0), timeouts, rate limiting and server errors are,
+// other client errors are not.
+func retryableWebhookStatus(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
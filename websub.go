@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+const (
+	// Lease requested from hubs, which may grant a different one
+	websubLeaseSeconds = 10 * 24 * 60 * 60
+	// Active subscriptions are renewed when their lease has this long left
+	websubRenewBefore = 24 * time.Hour
+	// Subscriptions that weren't verified, or were denied, are retried after
+	// this long
+	websubRetryAfter = 6 * time.Hour
+	// Feeds with an active subscription are still polled this often, in case
+	// the hub misses updates
+	websubPollInterval   = 24 * time.Hour
+	websubDefaultListen  = ":8080"
+	websubRequestTimeout = 30 * time.Second
+	maxWebSubPushBytes   = 10 << 20
+	// Pushes waiting to be stored beyond this many are refused, so the hub
+	// retries them later
+	websubQueueSize = 100
+)
+
+const websubStateDenied = "denied"
+
+// Hash functions for the X-Hub-Signature methods WebSub allows.
+var websubSignatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// websubSubscriber runs the callback server that hubs verify subscriptions
+// with and push new content to. Each feed has its own callback url,
+// <callback_url>/websub/<feed_id>.
+type websubSubscriber struct {
+	callbackBase *url.URL
+	server       *http.Server
+	// Pushed content is acknowledged straight away and stored in the
+	// background, as hubs expect a quick answer
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan websubPush
+	wg     sync.WaitGroup
+	// Guards queue against sends once it is closed
+	mu     sync.Mutex
+	closed bool
+}
+
+type websubPush struct {
+	feedEntry database.Feed
+	feed      *RSSFeed
+}
+
+// startWebSub starts the callback server if websub_callback_url is set,
+// returning nil otherwise.
+func startWebSub(s *state) (*websubSubscriber, error) {
+	if s.cfg.WebSubCallbackURL == "" {
+		return nil, nil
+	}
+	callbackBase, err := url.Parse(s.cfg.WebSubCallbackURL)
+	if err != nil || (callbackBase.Scheme != "http" && callbackBase.Scheme != "https") || callbackBase.Host == "" {
+		return nil, fmt.Errorf("websub_callback_url must be an http or https url")
+	}
+	listen := s.cfg.WebSubListen
+	if listen == "" {
+		listen = websubDefaultListen
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start WebSub callback server: %w", err)
+	}
+
+	subscriber := newWebSubSubscriber(s, callbackBase)
+	go func() {
+		err := subscriber.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("WebSub callback server stopped: %s\n", err)
+		}
+	}()
+	fmt.Printf("Listening for WebSub callbacks on %s\n", listener.Addr())
+	return subscriber, nil
+}
+
+// newWebSubSubscriber sets up the callback server's handlers, for hubs to
+// reach at callbackBase, and starts the worker that stores pushed posts.
+func newWebSubSubscriber(s *state, callbackBase *url.URL) *websubSubscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	subscriber := &websubSubscriber{
+		callbackBase: callbackBase,
+		ctx:          ctx,
+		cancel:       cancel,
+		queue:        make(chan websubPush, websubQueueSize),
+	}
+	subscriber.wg.Add(1)
+	go func() {
+		defer subscriber.wg.Done()
+		for push := range subscriber.queue {
+			subscriber.ingest(s, push)
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /websub/{feed_id}", func(w http.ResponseWriter, r *http.Request) {
+		subscriber.handleVerification(s, w, r)
+	})
+	mux.HandleFunc("POST /websub/{feed_id}", func(w http.ResponseWriter, r *http.Request) {
+		subscriber.handleContent(s, w, r)
+	})
+	subscriber.server = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  websubRequestTimeout,
+		WriteTimeout: websubRequestTimeout,
+	}
+	return subscriber
+}
+
+// stop shuts down the callback server, cancels storing the push in
+// progress, skips the ones still waiting and waits for the worker to finish.
+// Skipped posts are picked up when the feed is next polled.
+func (subscriber *websubSubscriber) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	subscriber.server.Shutdown(ctx)
+	subscriber.mu.Lock()
+	subscriber.closed = true
+	close(subscriber.queue)
+	subscriber.mu.Unlock()
+	subscriber.cancel()
+	subscriber.wg.Wait()
+}
+
+func (subscriber *websubSubscriber) callbackURL(feedID uuid.UUID) string {
+	return subscriber.callbackBase.JoinPath("websub", feedID.String()).String()
+}
+
+// websubLinks returns the feed's first advertised hub, if any, and the topic
+// url to subscribe to: its self link, or else the url it was fetched from.
+func websubLinks(feed *RSSFeed, feedUrl string) (string, string) {
+	hub, topic := "", feedUrl
+	selfFound := false
+	for _, link := range feed.Channel.AtomLinks {
+		for _, rel := range strings.Fields(strings.ToLower(link.Rel)) {
+			switch {
+			case rel == "hub" && hub == "":
+				hub = link.Href
+			case rel == "self" && !selfFound && link.Href != "":
+				topic = link.Href
+				selfFound = true
+			}
+		}
+	}
+	return hub, topic
+}
+
+// parseLinkHeader reads the links in HTTP Link headers, such as
+// `<https://hub.example.com/>; rel="hub"`.
+func parseLinkHeader(values []string) []RSSAtomLink {
+	links := []RSSAtomLink{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			end := strings.Index(part, ">")
+			if !strings.HasPrefix(part, "<") || end < 0 {
+				continue
+			}
+			link := RSSAtomLink{Href: part[1:end]}
+			for _, param := range strings.Split(part[end+1:], ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "rel":
+					link.Rel = value
+				case "type":
+					link.Type = value
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// discover subscribes to the feed's hub when it advertises one that it isn't
+// already subscribed to, and drops the subscription of a feed that no
+// longer advertises a hub. Existing subscriptions are kept up by renew.
+func (subscriber *websubSubscriber) discover(ctx context.Context, s *state, feedEntry database.Feed, feed *RSSFeed) error {
+	hub, topic := websubLinks(feed, feedEntry.Url)
+	if hub == "" {
+		// Without a subscription the feed is polled as usual again, and the
+		// callback answers any further pushes with 410 Gone
+		dropped, err := s.dbq.DeleteWebSubSubscription(ctx, feedEntry.ID)
+		if err != nil {
+			return fmt.Errorf("unable to remove subscription: %w", err)
+		}
+		if dropped > 0 {
+			fmt.Printf("Dropped WebSub subscription for %s, which no longer advertises a hub\n", feedEntry.Name)
+		}
+		return nil
+	}
+	secret := ""
+	subscription, err := s.dbq.GetWebSubSubscription(ctx, feedEntry.ID)
+	switch {
+	case err == nil:
+		if subscription.HubUrl == hub && subscription.TopicUrl == topic {
+			return nil
+		}
+		secret = subscription.Secret
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("unable to look up subscription: %w", err)
+	}
+	if secret == "" {
+		key := make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return fmt.Errorf("unable to generate secret: %w", err)
+		}
+		secret = hex.EncodeToString(key)
+	}
+	return subscriber.subscribe(ctx, s, feedEntry.ID, hub, topic, secret)
+}
+
+// renew resubscribes to hubs whose leases are running out, and retries
+// subscriptions that were never verified.
+func (subscriber *websubSubscriber) renew(ctx context.Context, s *state) error {
+	subscriptions, err := s.dbq.GetWebSubSubscriptionsToRenew(ctx, database.GetWebSubSubscriptionsToRenewParams{
+		RenewBefore: time.Now().Add(websubRenewBefore),
+		RetryBefore: time.Now().Add(-websubRetryAfter),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve WebSub subscriptions: %w", err)
+	}
+	for _, subscription := range subscriptions {
+		if ctx.Err() != nil {
+			return nil
+		}
+		err = subscriber.subscribe(ctx, s, subscription.FeedID, subscription.HubUrl, subscription.TopicUrl, subscription.Secret)
+		if err != nil {
+			fmt.Printf("Unable to renew WebSub subscription to <%s>: %s\n", subscription.TopicUrl, err)
+		}
+	}
+	return nil
+}
+
+// subscribe asks the hub for a subscription. The hub confirms it
+// asynchronously by verifying the intent with the callback server.
+func (subscriber *websubSubscriber) subscribe(ctx context.Context, s *state, feedID uuid.UUID, hub, topic, secret string) error {
+	// Record the pending subscription first, as hubs may verify it before
+	// answering the request
+	_, err := s.dbq.UpsertWebSubSubscription(ctx, database.UpsertWebSubSubscriptionParams{
+		FeedID:    feedID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		HubUrl:    hub,
+		TopicUrl:  topic,
+		Secret:    secret,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record subscription: %w", err)
+	}
+
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {subscriber.callbackURL(feedID)},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.Itoa(websubLeaseSeconds)},
+	}
+	ctx, cancel := context.WithTimeout(ctx, websubRequestTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "POST", hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", "gator")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusAccepted && response.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("hub refused subscription: %s %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Printf("Requested WebSub subscription to <%s> from <%s>\n", topic, hub)
+	return nil
+}
+
+// handleVerification answers a hub confirming a subscription, or reporting
+// that it was denied. Only subscriptions gator asked for are confirmed.
+func (subscriber *websubSubscriber) handleVerification(s *state, w http.ResponseWriter, r *http.Request) {
+	subscription, ok := subscriber.findSubscription(s, w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("hub.topic") != subscription.TopicUrl {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		challenge := query.Get("hub.challenge")
+		if challenge == "" || subscription.State == websubStateDenied {
+			http.NotFound(w, r)
+			return
+		}
+		lease, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 {
+			lease = websubLeaseSeconds
+		}
+		err = s.dbq.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(time.Duration(lease) * time.Second), Valid: true},
+			UpdatedAt:      time.Now(),
+			FeedID:         subscription.FeedID,
+		})
+		if err != nil {
+			http.Error(w, "unable to activate subscription", http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("WebSub subscription to <%s> verified for %s\n", subscription.TopicUrl, time.Duration(lease)*time.Second)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, challenge)
+	case "denied":
+		err := s.dbq.SetWebSubSubscriptionState(r.Context(), database.SetWebSubSubscriptionStateParams{
+			State:     websubStateDenied,
+			UpdatedAt: time.Now(),
+			FeedID:    subscription.FeedID,
+		})
+		if err != nil {
+			http.Error(w, "unable to update subscription", http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("WebSub subscription to <%s> denied: %s\n", subscription.TopicUrl, query.Get("hub.reason"))
+		w.WriteHeader(http.StatusOK)
+	default:
+		// gator never unsubscribes, so an unsubscribe intent isn't ours
+		http.NotFound(w, r)
+	}
+}
+
+// handleContent acknowledges a feed document pushed by the hub and queues
+// its posts to be stored. Content without a valid signature is acknowledged
+// but ignored, as WebSub requires.
+func (subscriber *websubSubscriber) handleContent(s *state, w http.ResponseWriter, r *http.Request) {
+	subscription, ok := subscriber.findSubscription(s, w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebSubPushBytes+1))
+	if err != nil {
+		http.Error(w, "unable to read content", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebSubPushBytes {
+		http.Error(w, "content too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validWebSubSignature(subscription.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		fmt.Printf("Ignoring WebSub content for <%s> with a missing or invalid signature\n", subscription.TopicUrl)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	feed, err := parseFeed(body)
+	if err != nil {
+		http.Error(w, "unable to parse feed", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	feedEntry, err := s.dbq.GetFeed(ctx, subscription.FeedID)
+	if err != nil {
+		http.Error(w, "unable to find feed", http.StatusInternalServerError)
+		return
+	}
+	err = s.dbq.MarkWebSubPush(ctx, database.MarkWebSubPushParams{
+		LastPushAt: sql.NullTime{Time: time.Now(), Valid: true},
+		FeedID:     subscription.FeedID,
+	})
+	if err != nil {
+		http.Error(w, "unable to record push", http.StatusInternalServerError)
+		return
+	}
+	if !subscriber.enqueue(websubPush{feedEntry: feedEntry, feed: feed}) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many pushes waiting", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Printf("Received WebSub content for %s from <%s>\n", feedEntry.Name, subscription.HubUrl)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// enqueue queues pushed content to be stored, reporting whether there was
+// room for it.
+func (subscriber *websubSubscriber) enqueue(push websubPush) bool {
+	subscriber.mu.Lock()
+	defer subscriber.mu.Unlock()
+	if subscriber.closed {
+		return false
+	}
+	select {
+	case subscriber.queue <- push:
+		return true
+	default:
+		return false
+	}
+}
+
+// ingest stores the posts in pushed content.
+func (subscriber *websubSubscriber) ingest(s *state, push websubPush) {
+	if subscriber.ctx.Err() != nil {
+		fmt.Printf("Skipping WebSub content for %s: aggregator stopped\n", push.feedEntry.Name)
+		return
+	}
+	for _, item := range push.feed.Channel.Item {
+		err := addPost(item, push.feedEntry, subscriber.ctx, s)
+		if err == nil {
+			fmt.Printf("Found post: %s (published '%s')\n", item.Title, item.PubDate)
+		}
+	}
+}
+
+// findSubscription looks up the subscription for the callback url, replying
+// with 410 Gone when there is none so the hub stops calling it.
+func (subscriber *websubSubscriber) findSubscription(s *state, w http.ResponseWriter, r *http.Request) (database.WebsubSubscription, bool) {
+	feedID, err := uuid.Parse(r.PathValue("feed_id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return database.WebsubSubscription{}, false
+	}
+	subscription, err := s.dbq.GetWebSubSubscription(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no subscription", http.StatusGone)
+		return subscription, false
+	}
+	if err != nil {
+		http.Error(w, "unable to look up subscription", http.StatusInternalServerError)
+		return subscription, false
+	}
+	return subscription, true
+}
+
+// validWebSubSignature checks an X-Hub-Signature header, "<method>=<hex>",
+// against an HMAC of the body.
+func validWebSubSignature(secret, header string, body []byte) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	newHash, ok := websubSignatureHashes[strings.ToLower(method)]
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
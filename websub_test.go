@@ -0,0 +1,531 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jthughes/gatorcli/internal/config"
+	"github.com/jthughes/gatorcli/internal/database"
+)
+
+const websubTestFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+	<title>Pushed</title>
+	<link>https://example.com/</link>
+	<atom:link rel="hub" href="%s"/>
+	<atom:link rel="self" href="https://example.com/feed.xml"/>
+	<item>
+		<title>Hot off the hub</title>
+		<link>https://example.com/hot</link>
+	</item>
+</channel>
+</rss>`
+
+// fakeDB stands in for Postgres. Queries are recognised by the name sqlc puts
+// on their first line and answered by the handler set for that name; other
+// queries return no rows, and other statements change nothing.
+type fakeDB struct {
+	mu       sync.Mutex
+	handlers map[string]func(args []driver.Value) [][]driver.Value
+}
+
+func (db *fakeDB) open() *sql.DB {
+	return sql.OpenDB(fakeConnector{db})
+}
+
+func (db *fakeDB) run(query string, named []driver.NamedValue) [][]driver.Value {
+	fields := strings.Fields(query)
+	if len(fields) < 3 {
+		return nil
+	}
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	handler, ok := db.handlers[fields[2]]
+	if !ok {
+		return nil
+	}
+	return handler(args)
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("open with a connector") }
+
+type fakeConn struct{ db *fakeDB }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{rows: c.db.run(query, args)}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(len(c.db.run(query, args))), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// websubStore is the data the WebSub tests work with: one feed, its
+// subscription if any, and the posts stored from it. The subscription is
+// only used under the database's lock, as handlers change it.
+type websubStore struct {
+	db           *fakeDB
+	feed         database.Feed
+	subscription *database.WebsubSubscription
+	posts        chan string
+}
+
+func (store *websubStore) setSubscription(subscription *database.WebsubSubscription) {
+	store.db.mu.Lock()
+	defer store.db.mu.Unlock()
+	store.subscription = subscription
+}
+
+func (store *websubStore) currentSubscription() *database.WebsubSubscription {
+	store.db.mu.Lock()
+	defer store.db.mu.Unlock()
+	if store.subscription == nil {
+		return nil
+	}
+	subscription := *store.subscription
+	return &subscription
+}
+
+func newWebSubTestState(t *testing.T) (*state, *websubStore) {
+	t.Helper()
+	store := &websubStore{
+		feed: database.Feed{
+			ID:   uuid.New(),
+			Name: "Pushed",
+			Url:  "https://example.com/feed",
+		},
+		posts: make(chan string, 10),
+	}
+	nullTime := func(value driver.Value) sql.NullTime {
+		if value == nil {
+			return sql.NullTime{}
+		}
+		return sql.NullTime{Time: value.(time.Time), Valid: true}
+	}
+	forFeed := func(value driver.Value) bool {
+		return store.subscription != nil && value == store.subscription.FeedID.String()
+	}
+	store.db = &fakeDB{handlers: map[string]func(args []driver.Value) [][]driver.Value{
+		"GetFeed": func(args []driver.Value) [][]driver.Value {
+			if args[0] != store.feed.ID.String() {
+				return nil
+			}
+			feed := store.feed
+			return [][]driver.Value{{
+				feed.ID.String(), feed.CreatedAt, feed.UpdatedAt, feed.Name, feed.Url, feed.UserID.String(),
+				nil, "", "", "", "", "", "", nil, false, nil, nil,
+			}}
+		},
+		"GetWebSubSubscription": func(args []driver.Value) [][]driver.Value {
+			if !forFeed(args[0]) {
+				return nil
+			}
+			return [][]driver.Value{store.subscriptionRow()}
+		},
+		"UpsertWebSubSubscription": func(args []driver.Value) [][]driver.Value {
+			store.subscription = &database.WebsubSubscription{
+				FeedID:    uuid.MustParse(args[0].(string)),
+				CreatedAt: args[1].(time.Time),
+				UpdatedAt: args[2].(time.Time),
+				HubUrl:    args[3].(string),
+				TopicUrl:  args[4].(string),
+				Secret:    args[5].(string),
+				State:     "pending",
+			}
+			return [][]driver.Value{store.subscriptionRow()}
+		},
+		"ActivateWebSubSubscription": func(args []driver.Value) [][]driver.Value {
+			if !forFeed(args[2]) {
+				return nil
+			}
+			store.subscription.State = "active"
+			store.subscription.LeaseExpiresAt = nullTime(args[0])
+			return [][]driver.Value{{}}
+		},
+		"SetWebSubSubscriptionState": func(args []driver.Value) [][]driver.Value {
+			if !forFeed(args[2]) {
+				return nil
+			}
+			store.subscription.State = args[0].(string)
+			return [][]driver.Value{{}}
+		},
+		"MarkWebSubPush": func(args []driver.Value) [][]driver.Value {
+			if !forFeed(args[1]) {
+				return nil
+			}
+			store.subscription.LastPushAt = nullTime(args[0])
+			return [][]driver.Value{{}}
+		},
+		"DeleteWebSubSubscription": func(args []driver.Value) [][]driver.Value {
+			if !forFeed(args[0]) {
+				return nil
+			}
+			store.subscription = nil
+			return [][]driver.Value{{}}
+		},
+		"PostExists": func(args []driver.Value) [][]driver.Value {
+			return [][]driver.Value{{false}}
+		},
+		"CreatePost": func(args []driver.Value) [][]driver.Value {
+			store.posts <- args[3].(string)
+			// The inserted columns, with search_vector in its place
+			row := append(append([]driver.Value{}, args[:10]...), nil)
+			return [][]driver.Value{append(row, args[10:]...)}
+		},
+	}}
+	db := store.db.open()
+	t.Cleanup(func() { db.Close() })
+	s := &state{cfg: &config.Config{}, db: db, dbq: database.New(db)}
+	return s, store
+}
+
+func (store *websubStore) subscriptionRow() []driver.Value {
+	subscription := store.subscription
+	nullTime := func(value sql.NullTime) driver.Value {
+		if !value.Valid {
+			return nil
+		}
+		return value.Time
+	}
+	return []driver.Value{
+		subscription.FeedID.String(), subscription.CreatedAt, subscription.UpdatedAt,
+		subscription.HubUrl, subscription.TopicUrl, subscription.Secret, subscription.State,
+		nullTime(subscription.LeaseExpiresAt), nullTime(subscription.LastPushAt),
+	}
+}
+
+// startWebSubCallbacks serves the subscriber's callback handlers, as
+// startWebSub does, on a local test server.
+func startWebSubCallbacks(t *testing.T, s *state) (*websubSubscriber, *httptest.Server) {
+	t.Helper()
+	var subscriber *websubSubscriber
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriber.server.Handler.ServeHTTP(w, r)
+	}))
+	callbackBase, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriber = newWebSubSubscriber(s, callbackBase)
+	t.Cleanup(func() {
+		server.Close()
+		subscriber.stop()
+	})
+	return subscriber, server
+}
+
+// hubStandIn is a minimal WebSub hub: it accepts a subscription, verifies the
+// intent with the subscriber's callback, then pushes signed content to it.
+type hubStandIn struct {
+	server  *httptest.Server
+	content []byte
+	results chan hubResult
+}
+
+type hubResult struct {
+	form     url.Values
+	verified bool
+	pushed   int
+	err      error
+}
+
+func startHubStandIn(t *testing.T) *hubStandIn {
+	t.Helper()
+	hub := &hubStandIn{results: make(chan hubResult, 1)}
+	hub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.ParseForm() != nil || r.PostForm.Get("hub.mode") != "subscribe" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		// Hubs verify asynchronously, after answering the request
+		go hub.verifyAndPush(r.PostForm)
+	}))
+	t.Cleanup(hub.server.Close)
+	return hub
+}
+
+func (hub *hubStandIn) verifyAndPush(form url.Values) {
+	result := hubResult{form: form}
+	defer func() { hub.results <- result }()
+
+	response, err := http.Get(verificationURL(form.Get("hub.callback"), form.Get("hub.topic"), "challenge-123"))
+	if err != nil {
+		result.err = err
+		return
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	result.verified = response.StatusCode == http.StatusOK && string(body) == "challenge-123"
+	if !result.verified {
+		return
+	}
+	result.pushed, result.err = pushContent(form.Get("hub.callback"), form.Get("hub.secret"), hub.content)
+}
+
+func verificationURL(callback, topic, challenge string) string {
+	query := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.challenge":     {challenge},
+		"hub.lease_seconds": {"3600"},
+	}
+	return callback + "?" + query.Encode()
+}
+
+// pushContent posts content to a callback signed with secret, as a hub does.
+func pushContent(callback, secret string, content []byte) (int, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+	request, err := http.NewRequest("POST", callback, strings.NewReader(string(content)))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/rss+xml")
+	request.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.StatusCode, nil
+}
+
+func TestWebSubSubscribeWithHub(t *testing.T) {
+	s, store := newWebSubTestState(t)
+	subscriber, _ := startWebSubCallbacks(t, s)
+	hub := startHubStandIn(t)
+	hub.content = []byte(fmt.Sprintf(websubTestFeed, hub.server.URL))
+	feed, err := parseFeed(hub.content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = subscriber.discover(context.Background(), s, store.feed, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result hubResult
+	select {
+	case result = <-hub.results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub never verified the subscription")
+	}
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.form.Get("hub.topic") != "https://example.com/feed.xml" || result.form.Get("hub.callback") != subscriber.callbackURL(store.feed.ID) {
+		t.Errorf("unexpected subscription request: %v", result.form)
+	}
+	if !result.verified {
+		t.Fatal("callback didn't echo the challenge")
+	}
+	if result.pushed != http.StatusAccepted {
+		t.Fatalf("push answered %d, want 202", result.pushed)
+	}
+	select {
+	case title := <-store.posts:
+		if title != "Hot off the hub" {
+			t.Errorf("stored post %q", title)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushed post was never stored")
+	}
+
+	subscription := store.currentSubscription()
+	if subscription.State != "active" || subscription.Secret != result.form.Get("hub.secret") {
+		t.Errorf("subscription is %s with secret %q", subscription.State, subscription.Secret)
+	}
+	if lease := time.Until(subscription.LeaseExpiresAt.Time); lease < 59*time.Minute || lease > time.Hour {
+		t.Errorf("lease expires in %s, want about 1h", lease)
+	}
+	if !subscription.LastPushAt.Valid {
+		t.Error("push wasn't recorded")
+	}
+}
+
+func TestWebSubHubRefuses(t *testing.T) {
+	s, store := newWebSubTestState(t)
+	subscriber, _ := startWebSubCallbacks(t, s)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "topic not allowed", http.StatusForbidden)
+	}))
+	defer hub.Close()
+
+	err := subscriber.subscribe(context.Background(), s, store.feed.ID, hub.URL, store.feed.Url, "s3cret")
+	if err == nil || !strings.Contains(err.Error(), "topic not allowed") {
+		t.Fatalf("err = %v, want the hub's refusal", err)
+	}
+}
+
+func TestWebSubVerification(t *testing.T) {
+	s, store := newWebSubTestState(t)
+	subscriber, _ := startWebSubCallbacks(t, s)
+	store.setSubscription(&database.WebsubSubscription{
+		FeedID:   store.feed.ID,
+		HubUrl:   "https://hub.example.com/",
+		TopicUrl: "https://example.com/feed.xml",
+		Secret:   "s3cret",
+		State:    "pending",
+	})
+	callback := subscriber.callbackURL(store.feed.ID)
+	topic := "https://example.com/feed.xml"
+	get := func(target string) int {
+		t.Helper()
+		response, err := http.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	if status := get(verificationURL(callback, "https://example.com/other.xml", "abc")); status != http.StatusNotFound {
+		t.Errorf("wrong topic answered %d, want 404", status)
+	}
+	if status := get(verificationURL(callback, topic, "")); status != http.StatusNotFound {
+		t.Errorf("missing challenge answered %d, want 404", status)
+	}
+	if status := get(verificationURL(subscriber.callbackURL(uuid.New()), topic, "abc")); status != http.StatusGone {
+		t.Errorf("unknown feed answered %d, want 410", status)
+	}
+	if state := store.currentSubscription().State; state != "pending" {
+		t.Fatalf("subscription is %s after rejected verifications", state)
+	}
+
+	denied := url.Values{
+		"hub.mode":   {"denied"},
+		"hub.topic":  {topic},
+		"hub.reason": {"not today"},
+	}
+	if status := get(callback + "?" + denied.Encode()); status != http.StatusOK {
+		t.Errorf("denial answered %d, want 200", status)
+	}
+	if state := store.currentSubscription().State; state != websubStateDenied {
+		t.Fatalf("subscription is %s, want denied", state)
+	}
+	if status := get(verificationURL(callback, topic, "abc")); status != http.StatusNotFound {
+		t.Errorf("verifying a denied subscription answered %d, want 404", status)
+	}
+}
+
+func TestWebSubContentSignature(t *testing.T) {
+	s, store := newWebSubTestState(t)
+	subscriber, _ := startWebSubCallbacks(t, s)
+	store.setSubscription(&database.WebsubSubscription{
+		FeedID:   store.feed.ID,
+		TopicUrl: "https://example.com/feed.xml",
+		Secret:   "s3cret",
+		State:    "active",
+	})
+	content := []byte(fmt.Sprintf(websubTestFeed, "https://hub.example.com/"))
+
+	status, err := pushContent(subscriber.callbackURL(store.feed.ID), "wrong", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Badly signed content is acknowledged, but ignored
+	if status != http.StatusAccepted {
+		t.Errorf("badly signed push answered %d, want 202", status)
+	}
+	status, err = pushContent(subscriber.callbackURL(uuid.New()), "s3cret", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusGone {
+		t.Errorf("push for an unknown feed answered %d, want 410", status)
+	}
+	if store.currentSubscription().LastPushAt.Valid {
+		t.Error("badly signed push was recorded")
+	}
+	select {
+	case title := <-store.posts:
+		t.Errorf("stored post %q from a badly signed push", title)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebSubDiscoverDropsSubscription(t *testing.T) {
+	s, store := newWebSubTestState(t)
+	subscriber, _ := startWebSubCallbacks(t, s)
+	store.setSubscription(&database.WebsubSubscription{
+		FeedID:   store.feed.ID,
+		HubUrl:   "https://hub.example.com/",
+		TopicUrl: store.feed.Url,
+		State:    "active",
+	})
+	feed, err := parseFeed([]byte(`<rss version="2.0"><channel><title>No hub</title></channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = subscriber.discover(context.Background(), s, store.feed, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.currentSubscription() != nil {
+		t.Error("subscription kept after the feed stopped advertising a hub")
+	}
+}